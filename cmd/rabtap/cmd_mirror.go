@@ -0,0 +1,129 @@
+// cmd_mirror - mirror tapped messages to another broker
+// Copyright (C) 2026 Jan Delgado
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/url"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// CmdMirrorArg contains the arguments for the mirror command
+type CmdMirrorArg struct {
+	tap       CmdTapArg         // the tap to mirror messages from. The messageSink is set by cmdMirror
+	toURL     *url.URL          // broker to publish the mirrored messages to
+	tlsConfig *tls.Config       // tls config of the destination broker
+	renames   map[string]string // optional, maps source to destination exchanges
+	rate      float64           // optional, max messages per second, 0 means unlimited
+	sample    float64           // ratio of messages to mirror, 1 mirrors all messages
+	out       io.Writer
+}
+
+// mirrorConfirmWindow is the max. number of mirrored messages waiting for a
+// confirmation of the destination broker
+const mirrorConfirmWindow = 100
+
+// mirrorStats counts the messages processed by the mirror command
+type mirrorStats struct {
+	published int64        // handed over to the publisher
+	sampled   int64        // not mirrored due to sampling
+	limited   int64        // not mirrored due to the rate limit
+	confirmed atomic.Int64 // confirmed by the destination broker
+	failed    atomic.Int64 // nacked, returned or failed to publish
+}
+
+// newMirrorMessageSink returns a MessageSink that publishes a sample of the
+// messages, with their original routing and properties, to the publish
+// channel. Messages exceeding the rate are dropped. The confirmations of the
+// published messages are counted in stats.
+func newMirrorMessageSink(ctx context.Context,
+	publishCh rabtap.PublishChannel,
+	cmd CmdMirrorArg,
+	random func() float64,
+	stats *mirrorStats,
+) MessageSink {
+	var limiter *TokenBucket
+	if cmd.rate > 0 {
+		limiter = NewTokenBucket(cmd.rate, max(1, int(cmd.rate)))
+	}
+	return func(message rabtap.TapMessage) error {
+		if random() >= cmd.sample {
+			stats.sampled++
+			return nil
+		}
+		if limiter != nil && !limiter.Allow() {
+			stats.limited++
+			return nil
+		}
+		msg := NewRabtapPersistentMessage(message)
+		exchange := msg.Exchange
+		if renamed, found := cmd.renames[exchange]; found {
+			exchange = renamed
+		}
+		routing := routingFromMessage(&exchange, nil, rabtap.KeyValueMap{}, msg)
+		publishing := msg.ToAmqpPublishing()
+		confirmed := func(ack bool) {
+			if ack {
+				stats.confirmed.Add(1)
+			} else {
+				stats.failed.Add(1)
+			}
+		}
+		select {
+		case publishCh <- &rabtap.PublishMessage{Routing: routing, Publishing: &publishing, Confirmed: confirmed}:
+			stats.published++
+		case <-ctx.Done():
+		}
+		return nil
+	}
+}
+
+// cmdMirror taps the given exchanges and republishes the received messages to
+// another broker, optionally renaming the exchanges. Use the sample ratio and
+// the rate to limit the number of mirrored messages. Messages are published
+// with publisher confirms, so only messages accepted by the destination broker
+// are reported as mirrored.
+func cmdMirror(ctx context.Context, cmd CmdMirrorArg, logger *slog.Logger) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	publisher := rabtap.NewAmqpPublish(cmd.toURL, cmd.tlsConfig, false, true, logger).
+		WithConfirmWindow(mirrorConfirmWindow)
+	publishCh := make(rabtap.PublishChannel)
+	errorCh := make(rabtap.PublishErrorChannel)
+
+	g.Go(func() error {
+		for err := range errorCh {
+			logger.Error("publishing error", "error", err)
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		err := publisher.EstablishConnection(ctx, publishCh, errorCh)
+		close(errorCh)
+		return err
+	})
+
+	var stats mirrorStats
+	g.Go(func() error {
+		defer close(publishCh)
+		tap := cmd.tap
+		tap.messageSink = newMirrorMessageSink(ctx, publishCh, cmd, rand.Float64, &stats)
+		return cmdTap(ctx, tap, logger)
+	})
+
+	err := g.Wait()
+	_, _ = fmt.Fprintf(cmd.out, "mirrored %d messages, %d failed, dropped %d messages by sampling and %d messages by rate limit\n",
+		stats.confirmed.Load(), stats.failed.Load(), stats.sampled, stats.limited)
+	return err
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2026 Jan Delgado
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/jandelgado/rabtap/pkg/testcommon"
+)
+
+func TestMirrorMessageSinkPublishesWithOriginalRoutingAndRenamedExchange(t *testing.T) {
+	publishCh := make(rabtap.PublishChannel, 1)
+	cmd := CmdMirrorArg{renames: map[string]string{"orders": "orders-staging"}, sample: 1}
+	var stats mirrorStats
+	sink := newMirrorMessageSink(context.Background(), publishCh, cmd, func() float64 { return 0.5 }, &stats)
+
+	err := sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{
+		Exchange:    "orders",
+		RoutingKey:  "key",
+		ContentType: "text/plain",
+		Headers:     amqp.Table{"a": "b"},
+		Body:        []byte("hello"),
+	}})
+
+	require.NoError(t, err)
+	message := <-publishCh
+	assert.Equal(t, "orders-staging", message.Routing.Exchange())
+	assert.Equal(t, "key", message.Routing.Key())
+	assert.Equal(t, "b", message.Routing.Headers()["a"])
+	assert.Equal(t, "text/plain", message.Publishing.ContentType)
+	assert.Equal(t, []byte("hello"), message.Publishing.Body)
+	assert.Equal(t, int64(1), stats.published)
+
+	message.Confirmed(true)
+	assert.Equal(t, int64(1), stats.confirmed.Load())
+	assert.Equal(t, int64(0), stats.failed.Load())
+}
+
+func TestMirrorMessageSinkDropsMessagesNotSampled(t *testing.T) {
+	publishCh := make(rabtap.PublishChannel, 10)
+	var stats mirrorStats
+	random := []float64{0.1, 0.5, 0.2, 0.9}
+	sink := newMirrorMessageSink(context.Background(), publishCh, CmdMirrorArg{sample: 0.3},
+		func() float64 { r := random[0]; random = random[1:]; return r }, &stats)
+
+	for range 4 {
+		require.NoError(t, sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{}}))
+	}
+
+	assert.Len(t, publishCh, 2)
+	assert.Equal(t, int64(2), stats.published)
+	assert.Equal(t, int64(2), stats.sampled)
+}
+
+func TestMirrorMessageSinkDropsMessagesExceedingTheRate(t *testing.T) {
+	publishCh := make(rabtap.PublishChannel, 10)
+	var stats mirrorStats
+	sink := newMirrorMessageSink(context.Background(), publishCh, CmdMirrorArg{sample: 1, rate: 2},
+		func() float64 { return 0 }, &stats)
+
+	for range 5 {
+		require.NoError(t, sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{}}))
+	}
+
+	assert.Len(t, publishCh, 2)
+	assert.Equal(t, int64(2), stats.published)
+	assert.Equal(t, int64(3), stats.limited)
+}
+
+func TestCmdMirrorIntegration(t *testing.T) {
+	// messages tapped on amq.topic are mirrored to the exchange mirror-exchange
+	setup, err := testcommon.IntegrationTestConnection("mirror-exchange", "topic", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+	key := setup.QueueName(0)
+
+	// message must be published, after rabtap mirror command is started
+	go func() {
+		time.Sleep(3 * time.Second)
+		err := setup.Chan.Publish("amq.topic", key, false, false,
+			amqp.Publishing{Body: []byte("Hello"), ContentType: "text/plain"})
+		require.NoError(t, err)
+	}()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	uri := testcommon.IntegrationURIFromEnv().String()
+	os.Args = []string{
+		"rabtap", "mirror",
+		"--uri", uri,
+		"amq.topic:" + key,
+		"--to-uri", uri,
+		"--rename-exchange=amq.topic=mirror-exchange",
+		"--limit=1",
+	}
+
+	output := testcommon.CaptureOutput(rabtapMain)
+
+	assert.Contains(t, output, "mirrored 1 messages, 0 failed")
+	message, ok, err := setup.Chan.Get(key, true)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []byte("Hello"), message.Body)
+}
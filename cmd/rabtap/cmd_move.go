@@ -0,0 +1,173 @@
+// move messages from a queue to an exchange
+// Copyright (C) 2026 Jan Delgado
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+var (
+	errNotConfirmed    = errors.New("message was not confirmed by the destination broker")
+	errNotDeadLettered = errors.New("message has no x-death header")
+)
+
+// CmdMoveArg contains the arguments for the move command
+type CmdMoveArg struct {
+	amqpURL    *url.URL // broker of the source queue
+	toURL      *url.URL // broker of the destination exchange
+	tlsConfig  *tls.Config
+	queue      string
+	exchange   string
+	toOrigin   bool    // publish to the original exchange of dead-lettered messages
+	routingKey *string // optional, overrides the routing key of the messages
+	headers    rabtap.KeyValueMap
+	properties PropertiesOverride
+	filterPred Predicate
+	termPred   Predicate
+	ackMode    AckMode
+	prefetch   int
+	timeout    time.Duration
+	out        io.Writer
+}
+
+// countingPred counts the number of times a predicate evaluated to false
+type countingPred struct {
+	Predicate
+	numFalse int64
+}
+
+func (s *countingPred) Eval(env map[string]interface{}) (bool, error) {
+	res, err := s.Predicate.Eval(env)
+	if err == nil && !res {
+		s.numFalse++
+	}
+	return res, err
+}
+
+// newMoveMessageSink returns a MessageSink, which publishes each message to
+// the destination and waits for the confirmation of the broker. In toOrigin
+// mode, the messages are published to the exchange and with the routing key
+// recorded in their dead-letter history. The number of confirmed messages is
+// counted in numMoved.
+func newMoveMessageSink(ctx context.Context,
+	publishCh rabtap.PublishChannel,
+	cmd CmdMoveArg,
+	numMoved *int64,
+) MessageSink {
+	return func(message rabtap.TapMessage) error {
+		msg := NewRabtapPersistentMessage(message)
+		msg.WithProperties(cmd.properties)
+		exchange, routingKey := cmd.exchange, cmd.routingKey
+		if cmd.toOrigin {
+			originExchange, originKey, ok := rabtap.DeathOrigin(msg.Headers)
+			if !ok {
+				return errNotDeadLettered
+			}
+			exchange = originExchange
+			if routingKey == nil {
+				routingKey = &originKey
+			}
+		}
+		routing := routingFromMessage(&exchange, routingKey, cmd.headers, msg)
+		publishing := msg.ToAmqpPublishing()
+
+		acks := make(chan bool, 1)
+		select {
+		case publishCh <- &rabtap.PublishMessage{
+			Routing:    routing,
+			Publishing: &publishing,
+			Confirmed:  func(ack bool) { acks <- ack },
+		}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case ack := <-acks:
+			if !ack {
+				return errNotConfirmed
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		*numMoved++
+		return nil
+	}
+}
+
+// cmdMove moves the messages of a queue to an exchange, optionally on another
+// broker. Each message is acknowledged on the source queue only after the
+// destination broker confirmed it. Moving stops when all messages which were
+// in the queue at the start were received, the limit is reached, no message
+// was received within the idle timeout, or a message could not be moved,
+// which is then requeued. Messages not passing the filter are kept in the
+// source queue, and unacknowledged until the end, so at most prefetch messages
+// can be skipped. Since each message is confirmed before the next one is
+// published, a move takes one round trip to the destination per message.
+func cmdMove(ctx context.Context, cmd CmdMoveArg, logger *slog.Logger) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	// unroutable messages are returned and thus not acknowledged on the source
+	publisher := rabtap.NewAmqpPublish(cmd.toURL, cmd.tlsConfig, true, true, logger)
+	publishCh := make(rabtap.PublishChannel)
+	errorCh := make(rabtap.PublishErrorChannel)
+
+	g.Go(func() error {
+		for err := range errorCh {
+			logger.Error("publishing error", "error", err)
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		err := publisher.EstablishConnection(ctx, publishCh, errorCh)
+		close(errorCh)
+		return err
+	})
+
+	filterPred := &countingPred{Predicate: cmd.filterPred}
+	numMoved := int64(0)
+	g.Go(func() error {
+		defer close(publishCh)
+		return cmdSubscribe(ctx, CmdSubscribeArg{
+			amqpURL:     cmd.amqpURL,
+			queue:       cmd.queue,
+			tlsConfig:   cmd.tlsConfig,
+			messageSink: newMoveMessageSink(ctx, publishCh, cmd, &numMoved),
+			filterPred:  filterPred,
+			termPred:    cmd.termPred,
+			args:        rabtap.KeyValueMap{},
+			timeout:     cmd.timeout,
+			prefetch:    cmd.prefetch,
+			ackBatch:    1,
+			ackMode:     cmd.ackMode,
+			drain:       true,
+		}, logger)
+	})
+
+	err := g.Wait()
+	destination := "exchange " + cmd.exchange
+	if cmd.toOrigin {
+		destination = "original exchanges"
+	}
+	_, _ = fmt.Fprintf(cmd.out, "moved %d messages from queue %s to %s, skipped %d messages\n",
+		numMoved, cmd.queue, destination, filterPred.numFalse)
+	// skipped messages are kept unacknowledged, so no further messages are
+	// delivered once they fill the prefetch window
+	if cmd.ackMode == AckOnFiltered && cmd.prefetch > 0 && filterPred.numFalse >= int64(cmd.prefetch) {
+		logger.Warn("skipped messages reached the prefetch limit, remaining messages were not examined",
+			"prefetch", cmd.prefetch)
+	}
+	return err
+}
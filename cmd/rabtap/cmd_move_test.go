@@ -0,0 +1,209 @@
+// Copyright (C) 2026 Jan Delgado
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/jandelgado/rabtap/pkg/testcommon"
+)
+
+func TestMoveMessageSinkPublishesMessageAndWaitsForConfirm(t *testing.T) {
+	publishCh := make(rabtap.PublishChannel, 1)
+	routingKey := "newkey"
+	contentType := "text/plain"
+	cmd := CmdMoveArg{
+		exchange:   "exchange",
+		routingKey: &routingKey,
+		headers:    rabtap.KeyValueMap{},
+		properties: PropertiesOverride{ContentType: &contentType},
+	}
+	numMoved := int64(0)
+	sink := newMoveMessageSink(context.Background(), publishCh, cmd, &numMoved)
+
+	go func() {
+		message := <-publishCh
+		assert.Equal(t, "exchange", message.Routing.Exchange())
+		assert.Equal(t, "newkey", message.Routing.Key())
+		assert.Equal(t, "text/plain", message.Publishing.ContentType)
+		assert.Equal(t, []byte("hello"), message.Publishing.Body)
+		message.Confirmed(true)
+	}()
+	err := sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{RoutingKey: "key", Body: []byte("hello")}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), numMoved)
+}
+
+func TestMoveMessageSinkFailsWhenMessageIsNotConfirmed(t *testing.T) {
+	publishCh := make(rabtap.PublishChannel, 1)
+	numMoved := int64(0)
+	sink := newMoveMessageSink(context.Background(), publishCh,
+		CmdMoveArg{headers: rabtap.KeyValueMap{}}, &numMoved)
+
+	go func() { (<-publishCh).Confirmed(false) }()
+	err := sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{}})
+
+	assert.ErrorIs(t, err, errNotConfirmed)
+	assert.Equal(t, int64(0), numMoved)
+}
+
+func TestMoveMessageSinkPublishesToOriginOfDeadLetteredMessage(t *testing.T) {
+	publishCh := make(rabtap.PublishChannel, 1)
+	numMoved := int64(0)
+	sink := newMoveMessageSink(context.Background(), publishCh,
+		CmdMoveArg{toOrigin: true, headers: rabtap.KeyValueMap{}}, &numMoved)
+
+	go func() {
+		message := <-publishCh
+		assert.Equal(t, "orders", message.Routing.Exchange())
+		assert.Equal(t, "order.new", message.Routing.Key())
+		message.Confirmed(true)
+	}()
+	err := sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{
+		Exchange:   "dlx",
+		RoutingKey: "key",
+		Headers: amqp.Table{
+			"x-death": []interface{}{amqp.Table{
+				"queue":        "orders",
+				"reason":       "rejected",
+				"exchange":     "orders",
+				"routing-keys": []interface{}{"order.new"},
+			}},
+		},
+	}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), numMoved)
+}
+
+func TestMoveMessageSinkFailsToPublishToOriginIfMessageWasNotDeadLettered(t *testing.T) {
+	publishCh := make(rabtap.PublishChannel, 1)
+	numMoved := int64(0)
+	sink := newMoveMessageSink(context.Background(), publishCh,
+		CmdMoveArg{toOrigin: true, headers: rabtap.KeyValueMap{}}, &numMoved)
+
+	err := sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{}})
+
+	assert.ErrorIs(t, err, errNotDeadLettered)
+	assert.Empty(t, publishCh)
+	assert.Equal(t, int64(0), numMoved)
+}
+
+func TestIntegrationCmdMoveMovesMatchingMessages(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	const srcQueue = "move-src-queue-test"
+	const dstQueue = "move-dst-queue-test"
+
+	tlsConfig := &tls.Config{}
+	amqpURL := testcommon.IntegrationURIFromEnv()
+	for _, queue := range []string{srcQueue, dstQueue} {
+		err := cmdQueueCreate(CmdQueueCreateArg{
+			amqpURL:   amqpURL,
+			queue:     queue,
+			durable:   true,
+			tlsConfig: tlsConfig,
+		}, logger)
+		require.NoError(t, err)
+		defer func() { _ = cmdQueueRemove(amqpURL, queue, tlsConfig, logger) }()
+	}
+
+	setup, err := testcommon.IntegrationTestConnection("", "", 0, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+	for _, typ := range []string{"move", "keep", "move"} {
+		err = setup.Chan.Publish("", srcQueue, false, false,
+			amqp.Publishing{Body: []byte("Hello"), Type: typ})
+		require.NoError(t, err)
+	}
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = []string{
+		"rabtap", "move", srcQueue,
+		"--uri", amqpURL.String(),
+		"--to-exchange=",
+		"--routingkey", dstQueue,
+		"--filter=r.msg.Type == 'move'",
+	}
+
+	// when
+	output := testcommon.CaptureOutput(rabtapMain)
+
+	// then
+	assert.Contains(t, output, "moved 2 messages from queue move-src-queue-test to exchange , skipped 1 messages")
+	queue, err := setup.Chan.QueueDeclarePassive(srcQueue, true, false, false, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, queue.Messages)
+	queue, err = setup.Chan.QueueDeclarePassive(dstQueue, true, false, false, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, queue.Messages)
+}
+
+func TestIntegrationCmdMoveKeepsUnroutableMessagesInSourceQueue(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	const srcQueue = "move-unroutable-src-queue-test"
+	const exchange = "move-unbound-exchange-test"
+
+	tlsConfig := &tls.Config{}
+	amqpURL := testcommon.IntegrationURIFromEnv()
+	err := cmdQueueCreate(CmdQueueCreateArg{
+		amqpURL:   amqpURL,
+		queue:     srcQueue,
+		durable:   true,
+		tlsConfig: tlsConfig,
+	}, logger)
+	require.NoError(t, err)
+	defer func() { _ = cmdQueueRemove(amqpURL, srcQueue, tlsConfig, logger) }()
+	// the exchange has no bindings, so the moved message is returned
+	err = cmdExchangeCreate(CmdExchangeCreateArg{
+		amqpURL:      amqpURL,
+		exchange:     exchange,
+		exchangeType: "direct",
+		tlsConfig:    tlsConfig,
+	}, logger)
+	require.NoError(t, err)
+	defer func() { _ = cmdExchangeRemove(amqpURL, exchange, tlsConfig, logger) }()
+
+	setup, err := testcommon.IntegrationTestConnection("", "", 0, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+	err = setup.Chan.Publish("", srcQueue, false, false, amqp.Publishing{Body: []byte("Hello")})
+	require.NoError(t, err)
+
+	termPred, err := NewLoopCountPred(InfiniteMessages)
+	require.NoError(t, err)
+	filterPred, err := NewExprPredicate("true")
+	require.NoError(t, err)
+
+	err = cmdMove(context.Background(), CmdMoveArg{
+		amqpURL:    amqpURL,
+		toURL:      amqpURL,
+		tlsConfig:  tlsConfig,
+		queue:      srcQueue,
+		exchange:   exchange,
+		headers:    rabtap.KeyValueMap{},
+		filterPred: filterPred,
+		termPred:   termPred,
+		ackMode:    AckOnProcessed,
+		timeout:    time.Second,
+		out:        io.Discard,
+	}, logger)
+
+	assert.ErrorIs(t, err, errNotConfirmed)
+	queue, err := setup.Chan.QueueDeclarePassive(srcQueue, true, false, false, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, queue.Messages)
+}
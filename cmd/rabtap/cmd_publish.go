@@ -10,9 +10,10 @@ import (
 	"io"
 	"log/slog"
 	"net/url"
+	"os"
+	"sync/atomic"
 	"time"
 
-	amqp "github.com/rabbitmq/amqp091-go"
 	"golang.org/x/sync/errgroup"
 
 	rabtap "github.com/jandelgado/rabtap/pkg"
@@ -30,10 +31,71 @@ type CmdPublishArg struct {
 	fixedDelay *time.Duration
 	confirms   bool
 	mandatory  bool
+	// max. number of messages waiting for a confirmation, when confirms is set
+	confirmWindow int
+	// max. time publishing may be blocked by the broker, 0 waits forever
+	blockedTimeout time.Duration
+	// number of messages per transaction, 0 disables transactions
+	txBatchSize int
+	// optional file to write messages to, which could not be published
+	rejectFile string
+	// max. number of messages per second, 0 for no limit. Overrides the
+	// delays between messages.
+	rate float64
+	// print a throughput summary, e.g. when generating load
+	summary bool
+	out     io.Writer
 }
 
 type DelayFunc func(first, second *RabtapPersistentMessage)
 
+// publishStats counts the messages of the pub command
+type publishStats struct {
+	published atomic.Int64 // messages successfully published
+	errors    atomic.Int64 // publishing errors
+}
+
+// RejectFunc is called with messages that could not be published
+type RejectFunc func(msg RabtapPersistentMessage)
+
+// rejectFileWriter writes messages that could not be published to a file in
+// rabtap JSON format, so they can be published again later using
+// "rabtap pub --format=json". The file is created with the first message.
+type rejectFileWriter struct {
+	filename string
+	file     *os.File
+	count    int
+	logger   *slog.Logger
+}
+
+func (s *rejectFileWriter) write(msg RabtapPersistentMessage) {
+	if s.file == nil {
+		file, err := os.Create(s.filename)
+		if err != nil {
+			s.logger.Error("could not create reject file", "error", err)
+			return
+		}
+		s.file = file
+	}
+	data, err := JSONMarshal(msg)
+	if err == nil {
+		_, err = s.file.Write(append(data, '\n'))
+	}
+	if err != nil {
+		s.logger.Error("could not write rejected message", "file", s.filename, "error", err)
+		return
+	}
+	s.count++
+}
+
+func (s *rejectFileWriter) close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.logger.Warn("rejected messages written", "file", s.filename, "count", s.count)
+	return s.file.Close()
+}
+
 func multDuration(duration time.Duration, factor float64) time.Duration {
 	d := float64(duration.Nanoseconds()) * factor
 	return time.Duration(int(d))
@@ -53,19 +115,42 @@ func durationBetweenMessages(first, second *RabtapPersistentMessage,
 	firstTs := first.XRabtapReceivedTimestamp
 	secondTs := second.XRabtapReceivedTimestamp
 	delta := secondTs.Sub(firstTs)
+	if delta < 0 {
+		// second was recorded before first, e.g. the first message of the
+		// next round when repeating, which is published without delay.
+		return time.Duration(0)
+	}
 	return multDuration(delta, speed)
 }
 
 // publishMessage publishes a single message on the given exchange with the
-// provided routingkey
+// provided routingkey. If set, onReject is called with the message as
+// published, when publishing failed, and successfully published messages are
+// counted in stats.
 func publishMessage(publishChannel rabtap.PublishChannel,
 	routing rabtap.Routing,
-	amqpPublishing amqp.Publishing,
+	msg RabtapPersistentMessage,
+	onReject RejectFunc,
+	stats *publishStats,
 ) {
-	publishChannel <- &rabtap.PublishMessage{
+	amqpPublishing := msg.ToAmqpPublishing()
+	message := &rabtap.PublishMessage{
 		Routing:    routing,
 		Publishing: &amqpPublishing,
 	}
+	if onReject != nil || stats != nil {
+		message.Confirmed = func(ack bool) {
+			switch {
+			case ack && stats != nil:
+				stats.published.Add(1)
+			case !ack && onReject != nil:
+				msg.Exchange, msg.RoutingKey = routing.Exchange(), routing.Key()
+				msg.Headers = routing.Headers()
+				onReject(msg)
+			}
+		}
+	}
+	publishChannel <- message
 }
 
 // selectOptionalOrDefault returns either an optional string, if set, or
@@ -87,13 +172,16 @@ func routingFromMessage(optExchange, optRoutingKey *string, headers rabtap.KeyVa
 }
 
 // publishMessageStream publishes messages from the provided message stream
-// provided by readNextMessageFunc. When done closes the publishChannel
+// provided by readNextMessageFunc. When done closes the publishChannel.
+// onReject and stats are optional.
 func publishMessageStream(publishCh rabtap.PublishChannel,
 	optExchange *string,
 	optRoutingKey *string,
 	headers rabtap.KeyValueMap,
 	source MessageSource,
 	delayFunc DelayFunc,
+	onReject RejectFunc,
+	stats *publishStats,
 ) error {
 	defer func() {
 		close(publishCh)
@@ -115,7 +203,7 @@ func publishMessageStream(publishCh rabtap.PublishChannel,
 			// during publishing, header information in msg.Header will be overriden
 			// by header information in the routing object (if present). The
 			// latter are set on the command line using --header K=V options.
-			publishMessage(publishCh, routing, msg.ToAmqpPublishing())
+			publishMessage(publishCh, routing, msg, onReject, stats)
 			lastMsg = &msg
 		default:
 			return err
@@ -136,15 +224,32 @@ func cmdPublish(ctx context.Context, cmd CmdPublishArg, logger *slog.Logger) err
 
 	resultCh := make(chan error, 1)
 	publisher := rabtap.NewAmqpPublish(cmd.amqpURL,
-		cmd.tlsConfig, cmd.mandatory, cmd.confirms, logger)
+		cmd.tlsConfig, cmd.mandatory, cmd.confirms, logger).
+		WithConfirmWindow(cmd.confirmWindow).
+		WithBlockedTimeout(cmd.blockedTimeout)
+	if cmd.txBatchSize > 0 {
+		publisher = publisher.WithTransactions(cmd.txBatchSize)
+	}
 	publishCh := make(rabtap.PublishChannel)
 	errorCh := make(rabtap.PublishErrorChannel)
 
+	var bucket *TokenBucket
+	if cmd.rate > 0 {
+		bucket = NewTokenBucket(cmd.rate, 1)
+	}
+
 	delayFunc := func(first, second *RabtapPersistentMessage) {
-		if first == nil || second == nil {
+		var delay time.Duration
+		switch {
+		case bucket != nil:
+			if delay = bucket.Take(); delay == 0 {
+				return
+			}
+		case first == nil || second == nil:
 			return
+		default:
+			delay = durationBetweenMessages(first, second, cmd.speed, cmd.fixedDelay)
 		}
-		delay := durationBetweenMessages(first, second, cmd.speed, cmd.fixedDelay)
 		logger.Info("publisher sleeping", "delay", delay)
 		select {
 		case <-time.After(delay):
@@ -152,6 +257,24 @@ func cmdPublish(ctx context.Context, cmd CmdPublishArg, logger *slog.Logger) err
 		}
 	}
 
+	var stats publishStats
+	start := time.Now()
+	if cmd.summary {
+		defer func() {
+			elapsed := time.Since(start)
+			_, _ = fmt.Fprintf(cmd.out, "published %d messages in %s (%.1f msg/s) with %d errors\n",
+				stats.published.Load(), elapsed.Round(time.Millisecond),
+				float64(stats.published.Load())/elapsed.Seconds(), stats.errors.Load())
+		}()
+	}
+
+	var onReject RejectFunc
+	if cmd.rejectFile != "" {
+		rejects := &rejectFileWriter{filename: cmd.rejectFile, logger: logger}
+		defer func() { _ = rejects.close() }()
+		onReject = rejects.write
+	}
+
 	go func() {
 		// runs as long as source returns messages. Unfortunately, we
 		// can not stop a blocking read on a file like we do with channels
@@ -159,17 +282,16 @@ func cmdPublish(ctx context.Context, cmd CmdPublishArg, logger *slog.Logger) err
 		// avoid blocking when e.g. the user presses CTRL+S and then CTRL+C.
 		// TODO find better solution
 		resultCh <- publishMessageStream(publishCh, cmd.exchange,
-			cmd.routingKey, cmd.headers, cmd.source, delayFunc)
+			cmd.routingKey, cmd.headers, cmd.source, delayFunc, onReject, &stats)
 	}()
 
 	g.Go(func() error {
-		numPublishErrors := 0
 		// log all publishing errors
 		for err := range errorCh {
-			numPublishErrors++
+			stats.errors.Add(1)
 			logger.Error("publishing error", "error", err)
 		}
-		if numPublishErrors > 0 {
+		if stats.errors.Load() > 0 {
 			return fmt.Errorf("published with errors")
 		}
 		return nil
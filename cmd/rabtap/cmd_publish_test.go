@@ -4,9 +4,13 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
@@ -82,6 +86,15 @@ func TestDurationBetweenMessagesIsCalculatedCorrectly(t *testing.T) {
 		1., nil))
 }
 
+func TestDurationBetweenMessagesReturnsZeroIfSecondMessageIsOlder(t *testing.T) {
+	first := time.Unix(0, 1000)
+	second := time.Unix(0, 0)
+	assert.Equal(t, time.Duration(0), durationBetweenMessages(
+		&RabtapPersistentMessage{XRabtapReceivedTimestamp: first},
+		&RabtapPersistentMessage{XRabtapReceivedTimestamp: second},
+		2., nil))
+}
+
 func TestSelectOptionOrDefaultReturnsOptionalIfSet(t *testing.T) {
 	opt := "optional"
 	assert.Equal(t, "optional", selectOptionalOrDefault(&opt, "default"))
@@ -106,7 +119,7 @@ func TestPublishMessageStreamPublishesNextMessage(t *testing.T) {
 	pubCh := make(rabtap.PublishChannel, 1)
 	exchange := "exchange"
 	key := "key"
-	err := publishMessageStream(pubCh, &exchange, &key, rabtap.KeyValueMap{}, mockReader, delayer)
+	err := publishMessageStream(pubCh, &exchange, &key, rabtap.KeyValueMap{}, mockReader, delayer, nil, nil)
 
 	assert.Nil(t, err)
 	select {
@@ -135,10 +148,86 @@ func TestPublishMessageStreamPropagatesMessageReadError(t *testing.T) {
 	pubCh := make(rabtap.PublishChannel)
 	exchange := ""
 	key := "key"
-	err := publishMessageStream(pubCh, &exchange, &key, rabtap.KeyValueMap{}, mockReader, delayer)
+	err := publishMessageStream(pubCh, &exchange, &key, rabtap.KeyValueMap{}, mockReader, delayer, nil, nil)
 	assert.Equal(t, errors.New("error"), err)
 }
 
+func TestPublishMessageStreamRejectsMessagesNotPublished(t *testing.T) {
+	count := 0
+	mockReader := func() (RabtapPersistentMessage, error) {
+		count++
+		if count > 1 {
+			return RabtapPersistentMessage{}, io.EOF
+		}
+		return RabtapPersistentMessage{Exchange: "original", Body: []byte("hello")}, nil
+	}
+	delayer := func(first, second *RabtapPersistentMessage) {}
+	var rejected []RabtapPersistentMessage
+	onReject := func(msg RabtapPersistentMessage) { rejected = append(rejected, msg) }
+
+	pubCh := make(rabtap.PublishChannel, 1)
+	exchange := "exchange"
+	key := "key"
+	err := publishMessageStream(pubCh, &exchange, &key, rabtap.KeyValueMap{"A": "B"}, mockReader, delayer, onReject, nil)
+	require.NoError(t, err)
+
+	message := <-pubCh
+	message.Confirmed(true)
+	assert.Empty(t, rejected)
+	message.Confirmed(false)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, "exchange", rejected[0].Exchange)
+	assert.Equal(t, "key", rejected[0].RoutingKey)
+	assert.Equal(t, "B", rejected[0].Headers["A"])
+	assert.Equal(t, []byte("hello"), rejected[0].Body)
+}
+
+func TestPublishMessageStreamCountsOnlyPublishedMessages(t *testing.T) {
+	source := newSliceMessageSource("first", "second")
+	delayer := func(first, second *RabtapPersistentMessage) {}
+	var stats publishStats
+
+	pubCh := make(rabtap.PublishChannel, 2)
+	exchange := "exchange"
+	key := "key"
+	err := publishMessageStream(pubCh, &exchange, &key, rabtap.KeyValueMap{}, source, delayer, nil, &stats)
+	require.NoError(t, err)
+
+	(<-pubCh).Confirmed(true)
+	(<-pubCh).Confirmed(false)
+	assert.Equal(t, int64(1), stats.published.Load())
+}
+
+func TestRejectFileWriterWritesRejectedMessagesAsJSONStream(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rejects.json")
+	rejects := rejectFileWriter{filename: filename, logger: slog.New(slog.DiscardHandler)}
+
+	rejects.write(RabtapPersistentMessage{RoutingKey: "a", Body: []byte("1")})
+	rejects.write(RabtapPersistentMessage{RoutingKey: "b", Body: []byte("2")})
+	require.NoError(t, rejects.close())
+
+	file, err := os.Open(filename)
+	require.NoError(t, err)
+	source, err := NewReaderMessageSource("json", file)
+	require.NoError(t, err)
+	for _, expected := range []string{"1", "2"} {
+		msg, err := source()
+		require.NoError(t, err)
+		assert.Equal(t, []byte(expected), msg.Body)
+	}
+	_, err = source()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRejectFileWriterCreatesNoFileWithoutRejectedMessages(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rejects.json")
+	rejects := rejectFileWriter{filename: filename, logger: slog.New(slog.DiscardHandler)}
+
+	require.NoError(t, rejects.close())
+
+	assert.NoFileExists(t, filename)
+}
+
 func TestCmdPublishARawFileWithExchangeAndRoutingKey(t *testing.T) {
 	// integrative test publishing a raw file
 
@@ -349,3 +438,161 @@ func TestCmdPublishFilesFromDirectory(t *testing.T) {
 	assert.Equal(t, routingKey, message[0].RoutingKey)
 	assert.Equal(t, "Hello123", string(message[0].Body))
 }
+
+func TestCmdPublishRepeatsSourceWithRateAndPrintsSummary(t *testing.T) {
+	exchangeName := fmt.Sprintf("myexchange-%s", uuid.New().String())
+	setup, err := testcommon.IntegrationTestConnection(exchangeName, "topic", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	routingKey := setup.QueueName(0)
+	var out bytes.Buffer
+	source, replay := NewReplayableMessageSource(newSliceMessageSource("Hello", "Hello"))
+	start := time.Now()
+	err = cmdPublish(context.Background(), CmdPublishArg{
+		amqpURL:    testcommon.IntegrationURIFromEnv(),
+		exchange:   &exchangeName,
+		routingKey: &routingKey,
+		headers:    rabtap.KeyValueMap{},
+		tlsConfig:  &tls.Config{},
+		source:     NewRepeatingMessageSource(source, replay, 3),
+		rate:       20,
+		summary:    true,
+		out:        &out,
+	}, slog.New(slog.DiscardHandler))
+
+	require.NoError(t, err)
+	// the first message is published immediately, the other 5 at 20 msg/s
+	assert.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+	assert.Contains(t, out.String(), "published 6 messages in")
+	assert.Contains(t, out.String(), "with 0 errors")
+
+	doneChan := make(chan int)
+	testcommon.VerifyTestMessageOnQueue(t, setup.Chan, "consumer", 6, routingKey, doneChan)
+	assert.Equal(t, 6, <-doneChan)
+}
+
+func TestCmdPublishGeneratesMessagesFromTemplate(t *testing.T) {
+	exchangeName := fmt.Sprintf("myexchange-%s", uuid.New().String())
+	setup, err := testcommon.IntegrationTestConnection(exchangeName, "topic", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	queueName := setup.QueueName(0)
+	dir := t.TempDir()
+	templateFile := filepath.Join(dir, "message.tpl")
+	tpl := `{"RoutingKey": "` + queueName + `", "Headers": {"seq": "{{ .Seq }}"}, "Body": "{{ Pick .Data.bodies }}"}`
+	require.NoError(t, os.WriteFile(templateFile, []byte(tpl), 0o600))
+	dataFile := filepath.Join(dir, "data.json")
+	require.NoError(t, os.WriteFile(dataFile, []byte(`{"bodies": ["Hello"]}`), 0o600))
+
+	deliveries, err := setup.Chan.Consume(queueName, "test-consumer", true, true, false, false, nil)
+	require.NoError(t, err)
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = []string{
+		"rabtap", "pub",
+		"--uri", testcommon.IntegrationURIFromEnv().String(),
+		"--exchange", exchangeName,
+		"--generate", templateFile,
+		"--data", dataFile,
+		"--count=3",
+	}
+	main()
+
+	for _, seq := range []string{"1", "2", "3"} {
+		select {
+		case message := <-deliveries:
+			assert.Equal(t, queueName, message.RoutingKey)
+			assert.Equal(t, seq, message.Headers["seq"])
+			assert.Equal(t, "Hello", string(message.Body))
+		case <-time.After(time.Second * 2):
+			assert.Fail(t, "did not receive message within expected time")
+		}
+	}
+}
+
+func TestCmdPublishACSVFileWithFieldMapping(t *testing.T) {
+	exchangeName := fmt.Sprintf("myexchange-%s", uuid.New().String())
+	setup, err := testcommon.IntegrationTestConnection(exchangeName, "topic", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	queueName := setup.QueueName(0)
+	csvFile := filepath.Join(t.TempDir(), "messages.csv")
+	csv := "key,tenant,payload\n" + queueName + ",acme,first\n" + queueName + ",umbrella,second\n"
+	require.NoError(t, os.WriteFile(csvFile, []byte(csv), 0o600))
+
+	deliveries, err := setup.Chan.Consume(queueName, "test-consumer", true, true, false, false, nil)
+	require.NoError(t, err)
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = []string{
+		"rabtap", "pub",
+		"--uri", testcommon.IntegrationURIFromEnv().String(),
+		"--exchange", exchangeName,
+		csvFile,
+		"--format=csv",
+		"--map=RoutingKey=key",
+		"--map=Header.tenant=tenant",
+		"--map=Body=payload",
+	}
+	main()
+
+	for _, expected := range []struct{ tenant, body string }{{"acme", "first"}, {"umbrella", "second"}} {
+		select {
+		case message := <-deliveries:
+			assert.Equal(t, queueName, message.RoutingKey)
+			assert.Equal(t, expected.tenant, message.Headers["tenant"])
+			assert.Equal(t, expected.body, string(message.Body))
+		case <-time.After(time.Second * 2):
+			assert.Fail(t, "did not receive message within expected time")
+		}
+	}
+}
+
+func TestCmdPublishFiltersAndTransformsMessages(t *testing.T) {
+	exchangeName := fmt.Sprintf("myexchange-%s", uuid.New().String())
+	setup, err := testcommon.IntegrationTestConnection(exchangeName, "topic", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	queueName := setup.QueueName(0)
+	jsonlFile := filepath.Join(t.TempDir(), "messages.jsonl")
+	jsonl := `{"tenant": "t1", "n": 1}` + "\n" + `{"tenant": "t2", "n": 2}` + "\n"
+	require.NoError(t, os.WriteFile(jsonlFile, []byte(jsonl), 0o600))
+
+	deliveries, err := setup.Chan.Consume(queueName, "test-consumer", true, true, false, false, nil)
+	require.NoError(t, err)
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = []string{
+		"rabtap", "pub",
+		"--uri", testcommon.IntegrationURIFromEnv().String(),
+		"--exchange", exchangeName,
+		jsonlFile,
+		"--format=jsonl-body",
+		"--filter=fromJSON(r.toStr(r.msg.Body)).tenant == 't2'",
+		"--transform=RoutingKey='" + queueName + "'",
+		"--transform=Header.tenant='test'",
+		"--transform=Body.tenant='test'",
+	}
+	main()
+
+	select {
+	case message := <-deliveries:
+		assert.Equal(t, queueName, message.RoutingKey)
+		assert.Equal(t, "test", message.Headers["tenant"])
+		assert.JSONEq(t, `{"tenant": "test", "n": 2}`, string(message.Body))
+	case <-time.After(time.Second * 2):
+		assert.Fail(t, "did not receive message within expected time")
+	}
+	select {
+	case message := <-deliveries:
+		assert.Fail(t, "unexpected message", string(message.Body))
+	case <-time.After(time.Millisecond * 500):
+	}
+}
@@ -5,8 +5,13 @@ package main
 
 import (
 	"crypto/tls"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/url"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
 
 	rabtap "github.com/jandelgado/rabtap/pkg"
 )
@@ -31,6 +36,16 @@ type CmdQueueBindArg struct {
 	tlsConfig  *tls.Config
 }
 
+// CmdQueuePeekArg contains the arguments for cmdQueuePeek
+type CmdQueuePeekArg struct {
+	amqpURL     *url.URL
+	queue       string
+	count       int
+	tlsConfig   *tls.Config
+	messageSink MessageSink
+	summaryOut  io.Writer // summary is written to, separated from the messages
+}
+
 func amqpHeaderRoutingMode(mode HeaderMode) string {
 	modes := map[HeaderMode]string{
 		HeaderMatchAny: "any",
@@ -77,6 +92,28 @@ func cmdQueuePurge(amqpURL *url.URL, queueName string, tlsConfig *tls.Config, lo
 		})
 }
 
+// cmdQueuePeek shows messages of a queue without consuming them. The messages
+// are taken with basic.get and are requeued afterwards. Finally the number of
+// messages in the queue, as reported by basic.get, is written to summaryOut
+// (e.g. stderr), which is kept apart from the output of the message sink.
+func cmdQueuePeek(cmd CmdQueuePeekArg, logger *slog.Logger) error {
+	return rabtap.SimpleAmqpConnector(cmd.amqpURL,
+		cmd.tlsConfig,
+		func(session rabtap.Session) error {
+			logger.Debug("peeking queue", "queue", cmd.queue, "count", cmd.count)
+			peeked := 0
+			num, err := rabtap.PeekQueue(session, cmd.queue, cmd.count,
+				func(message *amqp.Delivery) error {
+					peeked++
+					return cmd.messageSink(rabtap.NewTapMessage(message, time.Now()))
+				})
+			if err == nil {
+				_, _ = fmt.Fprintf(cmd.summaryOut, "peeked %d of %d messages in queue %s\n", peeked, num, cmd.queue)
+			}
+			return err
+		})
+}
+
 // cmdQueueBindToExchange binds a queue to an exchange
 func cmdQueueBindToExchange(cmd CmdQueueBindArg, logger *slog.Logger) error {
 	return rabtap.SimpleAmqpConnector(cmd.amqpURL, cmd.tlsConfig,
@@ -6,12 +6,16 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -90,3 +94,79 @@ func TestIntegrationCmdQueueCreatePurgeBindUnbindQueue(t *testing.T) {
 
 	// TODO check that queue is removed
 }
+
+func TestIntegrationCmdQueuePeekLeavesQueueUnchanged(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	const testQueue = "peek-queue-test"
+	amqpURL := testcommon.IntegrationURIFromEnv().String()
+
+	os.Args = []string{"rabtap", "queue", "create", testQueue, "--uri", amqpURL}
+	main()
+	defer func() {
+		os.Args = []string{"rabtap", "queue", "rm", testQueue, "--uri", amqpURL}
+		main()
+	}()
+
+	setup, err := testcommon.IntegrationTestConnection("", "", 0, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+	for _, body := range []string{"first", "second", "third"} {
+		err = setup.Chan.Publish("", testQueue, false, false,
+			amqp.Publishing{Body: []byte(body), ContentType: "text/plain"})
+		require.NoError(t, err)
+	}
+
+	os.Args = []string{"rabtap", "queue", "peek", testQueue, "--uri", amqpURL,
+		"--count=2", "--no-color"}
+	output := testcommon.CaptureOutput(rabtapMain)
+
+	assert.Regexp(t, "(?s)first.*second", output)
+	assert.NotContains(t, output, "third")
+
+	queue, err := setup.Chan.QueueDeclarePassive(testQueue, true, false, false, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, queue.Messages)
+}
+
+func TestIntegrationCmdQueuePeekWritesOnlyMessagesInJSONFormat(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	const testQueue = "peek-queue-json-test"
+	amqpURL := testcommon.IntegrationURIFromEnv().String()
+
+	os.Args = []string{"rabtap", "queue", "create", testQueue, "--uri", amqpURL}
+	main()
+	defer func() {
+		os.Args = []string{"rabtap", "queue", "rm", testQueue, "--uri", amqpURL}
+		main()
+	}()
+
+	setup, err := testcommon.IntegrationTestConnection("", "", 0, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+	for _, body := range []string{"first", "second"} {
+		err = setup.Chan.Publish("", testQueue, false, false,
+			amqp.Publishing{Body: []byte(body), ContentType: "text/plain"})
+		require.NoError(t, err)
+	}
+
+	os.Args = []string{"rabtap", "queue", "peek", testQueue, "--uri", amqpURL,
+		"--count=2", "--format=json", "--no-color"}
+	output := testcommon.CaptureOutput(rabtapMain)
+
+	// stdout must be a stream of JSON messages only
+	decoder := json.NewDecoder(strings.NewReader(output))
+	var bodies []string
+	for {
+		msg, err := readMessageFromJSONStream(decoder)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		bodies = append(bodies, string(msg.Body))
+	}
+	assert.Equal(t, []string{"first", "second"}, bodies)
+}
@@ -0,0 +1,256 @@
+// respond - answer requests with recorded replies
+// Copyright (C) 2026 Jan Delgado
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// CmdRespondArg contains the arguments for the respond command
+type CmdRespondArg struct {
+	amqpURL   *url.URL
+	tlsConfig *tls.Config
+	queue     string
+	replies   []recordedReply
+	delay     time.Duration // delay of replies without XRabtapReplyDelay
+	termPred  Predicate
+	timeout   time.Duration
+	out       io.Writer
+}
+
+// recordedReply is a reply loaded from a directory, along with the predicate
+// selecting the requests it is sent for
+type recordedReply struct {
+	message RabtapPersistentMessage
+	pred    Predicate
+	delay   *time.Duration // optional, overrides the default delay
+}
+
+// maxDelayedReplies is the max. number of delayed replies waiting to be
+// published. When reached, no further requests are processed until a delayed
+// reply was published.
+const maxDelayedReplies = 1000
+
+// respondStats counts the requests processed by the respond command
+type respondStats struct {
+	received  int64
+	unmatched int64        // no recorded reply matched the request
+	noReplyTo int64        // request had no ReplyTo property
+	replied   atomic.Int64 // updated by the delayed replies
+}
+
+// newRecordedReply creates a recordedReply from the given message. The
+// predicate is taken from the XRabtapReplyIf field and defaults to true.
+func newRecordedReply(msg RabtapPersistentMessage) (recordedReply, error) {
+	cond := msg.XRabtapReplyIf
+	if cond == "" {
+		cond = "true"
+	}
+	pred, err := NewExprPredicate(cond)
+	if err != nil {
+		return recordedReply{}, fmt.Errorf("invalid XRabtapReplyIf %q: %w", cond, err)
+	}
+	reply := recordedReply{message: msg, pred: pred}
+	if msg.XRabtapReplyDelay != "" {
+		delay, err := time.ParseDuration(msg.XRabtapReplyDelay)
+		if err != nil {
+			return recordedReply{}, fmt.Errorf("invalid XRabtapReplyDelay: %w", err)
+		}
+		reply.delay = &delay
+	}
+	return reply, nil
+}
+
+// loadRecordedReplies loads the replies saved in the given directory in the
+// given format, in the order they were recorded
+func loadRecordedReplies(dir, format string) ([]recordedReply, error) {
+	metadataFiles, err := LoadMetadataFilesFromDir(dir, os.ReadDir, NewRabtapFileInfoPredicate())
+	if err != nil {
+		return nil, fmt.Errorf("load message metadata: %w", err)
+	}
+	sort.SliceStable(metadataFiles, func(i, j int) bool {
+		return metadataFiles[i].metadata.XRabtapReceivedTimestamp.Before(
+			metadataFiles[j].metadata.XRabtapReceivedTimestamp)
+	})
+	source, err := NewReadFilesFromDirMessageSource(format, metadataFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var replies []recordedReply
+	for {
+		msg, err := source()
+		if errors.Is(err, io.EOF) {
+			return replies, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		reply, err := newRecordedReply(msg)
+		if err != nil {
+			return nil, fmt.Errorf("reply %d: %w", len(replies)+1, err)
+		}
+		replies = append(replies, reply)
+	}
+}
+
+// findReply returns the first reply whose predicate matches the request
+// described by env, or nil if no reply matches.
+func findReply(replies []recordedReply, env map[string]interface{}) (*recordedReply, error) {
+	for i := range replies {
+		match, err := replies[i].pred.Eval(env)
+		if err != nil {
+			return nil, fmt.Errorf("evaluate XRabtapReplyIf %d: %w", i+1, err)
+		}
+		if match {
+			return &replies[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// newRespondMessageSink returns a MessageSink that answers each request with
+// the first matching recorded reply. The reply is published to the ReplyTo
+// queue of the request using the default exchange, with the CorrelationId of
+// the request. Delayed replies are published in the background, so that
+// requests are received while replies are pending; pending is done when all
+// delayed replies were published or ctx was cancelled.
+func newRespondMessageSink(ctx context.Context,
+	publishCh rabtap.PublishChannel,
+	cmd CmdRespondArg,
+	stats *respondStats,
+	pending *sync.WaitGroup,
+	logger *slog.Logger,
+) MessageSink {
+	slots := make(chan struct{}, maxDelayedReplies)
+
+	publish := func(message *rabtap.PublishMessage, delay time.Duration) {
+		select {
+		case publishCh <- message:
+			logger.Info("replied to request", "correlation_id", message.Publishing.CorrelationId, "delay", delay)
+			stats.replied.Add(1)
+		case <-ctx.Done():
+		}
+	}
+
+	return func(message rabtap.TapMessage) error {
+		request := message.AmqpMessage
+		env := createMessagePredEnv(message, stats.received)
+		stats.received++
+		if request.ReplyTo == "" {
+			logger.Warn("ignoring request without reply-to", "correlation_id", request.CorrelationId)
+			stats.noReplyTo++
+			return nil
+		}
+		reply, err := findReply(cmd.replies, env)
+		if err != nil {
+			return err
+		}
+		if reply == nil {
+			logger.Warn("no reply matches request", "correlation_id", request.CorrelationId)
+			stats.unmatched++
+			return nil
+		}
+
+		msg := reply.message
+		msg.CorrelationID = request.CorrelationId
+		msg.ReplyTo = ""
+		routing := rabtap.NewRouting("", request.ReplyTo, msg.Headers)
+		publishing := msg.ToAmqpPublishing()
+		pubMsg := &rabtap.PublishMessage{Routing: routing, Publishing: &publishing}
+
+		delay := cmd.delay
+		if reply.delay != nil {
+			delay = *reply.delay
+		}
+		if delay <= 0 {
+			publish(pubMsg, delay)
+			return nil
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		pending.Add(1)
+		go func() {
+			defer pending.Done()
+			defer func() { <-slots }()
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				publish(pubMsg, delay)
+			case <-ctx.Done():
+			}
+		}()
+		return nil
+	}
+}
+
+// cmdRespond consumes requests from a queue and answers them with recorded
+// replies, standing in for a service in tests.
+func cmdRespond(ctx context.Context, cmd CmdRespondArg, logger *slog.Logger) error {
+	acceptAll, err := NewExprPredicate("true")
+	if err != nil {
+		return err
+	}
+	g, ctx := errgroup.WithContext(ctx)
+
+	publisher := rabtap.NewAmqpPublish(cmd.amqpURL, cmd.tlsConfig, false, false, logger)
+	publishCh := make(rabtap.PublishChannel)
+	errorCh := make(rabtap.PublishErrorChannel)
+
+	g.Go(func() error {
+		for err := range errorCh {
+			logger.Error("publishing error", "error", err)
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		err := publisher.EstablishConnection(ctx, publishCh, errorCh)
+		close(errorCh)
+		return err
+	})
+
+	var stats respondStats
+	var pending sync.WaitGroup
+	g.Go(func() error {
+		defer close(publishCh)
+		defer pending.Wait()
+		return cmdSubscribe(ctx, CmdSubscribeArg{
+			amqpURL:     cmd.amqpURL,
+			queue:       cmd.queue,
+			tlsConfig:   cmd.tlsConfig,
+			messageSink: newRespondMessageSink(ctx, publishCh, cmd, &stats, &pending, logger),
+			filterPred:  acceptAll,
+			termPred:    cmd.termPred,
+			args:        rabtap.KeyValueMap{},
+			timeout:     cmd.timeout,
+			ackMode:     AckOnReceive,
+		}, logger)
+	})
+
+	err = g.Wait()
+	_, _ = fmt.Fprintf(cmd.out, "replied to %d requests, ignored %d requests without matching reply and %d requests without reply-to\n",
+		stats.replied.Load(), stats.unmatched, stats.noReplyTo)
+	return err
+}
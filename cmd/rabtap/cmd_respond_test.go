@@ -0,0 +1,199 @@
+// Copyright (C) 2026 Jan Delgado
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/jandelgado/rabtap/pkg/testcommon"
+)
+
+// saveReplies saves the given replies as rabtap JSON files in dir
+func saveReplies(t *testing.T, dir string, replies ...RabtapPersistentMessage) {
+	for i, reply := range replies {
+		reply.XRabtapReceivedTimestamp = time.Unix(int64(i), 0)
+		data, err := json.Marshal(reply)
+		require.NoError(t, err)
+		filename := path.Join(dir, fmt.Sprintf("rabtap-%d.json", i))
+		require.NoError(t, os.WriteFile(filename, data, 0o600))
+	}
+}
+
+func mustNewRecordedReply(t *testing.T, msg RabtapPersistentMessage) recordedReply {
+	reply, err := newRecordedReply(msg)
+	require.NoError(t, err)
+	return reply
+}
+
+func TestLoadRecordedRepliesInRecordedOrder(t *testing.T) {
+	dir := t.TempDir()
+	saveReplies(t, dir,
+		RabtapPersistentMessage{Body: []byte("first"), XRabtapReplyIf: "r.msg.Type == 'a'", XRabtapReplyDelay: "10ms"},
+		RabtapPersistentMessage{Body: []byte("second")})
+
+	replies, err := loadRecordedReplies(dir, "json")
+
+	require.NoError(t, err)
+	require.Len(t, replies, 2)
+	assert.Equal(t, []byte("first"), replies[0].message.Body)
+	assert.Equal(t, 10*time.Millisecond, *replies[0].delay)
+	assert.Equal(t, []byte("second"), replies[1].message.Body)
+	assert.Nil(t, replies[1].delay)
+}
+
+func TestLoadRecordedRepliesFailsOnInvalidPredicate(t *testing.T) {
+	dir := t.TempDir()
+	saveReplies(t, dir, RabtapPersistentMessage{XRabtapReplyIf: "r.msg.Type =="})
+
+	_, err := loadRecordedReplies(dir, "json")
+
+	assert.ErrorContains(t, err, "invalid XRabtapReplyIf")
+}
+
+func TestRespondMessageSinkRepliesWithFirstMatchingReply(t *testing.T) {
+	publishCh := make(rabtap.PublishChannel, 1)
+	cmd := CmdRespondArg{replies: []recordedReply{
+		mustNewRecordedReply(t, RabtapPersistentMessage{Body: []byte("a"), XRabtapReplyIf: "r.msg.Type == 'a'"}),
+		mustNewRecordedReply(t, RabtapPersistentMessage{Body: []byte("default"), ContentType: "text/plain"}),
+	}}
+	var stats respondStats
+	var pending sync.WaitGroup
+	sink := newRespondMessageSink(context.Background(), publishCh, cmd, &stats, &pending, slog.New(slog.DiscardHandler))
+
+	err := sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{
+		Type: "b", ReplyTo: "reply-queue", CorrelationId: "42",
+	}})
+
+	require.NoError(t, err)
+	message := <-publishCh
+	assert.Equal(t, "", message.Routing.Exchange())
+	assert.Equal(t, "reply-queue", message.Routing.Key())
+	assert.Equal(t, "42", message.Publishing.CorrelationId)
+	assert.Equal(t, "text/plain", message.Publishing.ContentType)
+	assert.Equal(t, []byte("default"), message.Publishing.Body)
+	assert.Equal(t, int64(1), stats.replied.Load())
+}
+
+func TestRespondMessageSinkPassesNumberOfReceivedRequestsAsCount(t *testing.T) {
+	publishCh := make(rabtap.PublishChannel, 1)
+	cmd := CmdRespondArg{replies: []recordedReply{
+		mustNewRecordedReply(t, RabtapPersistentMessage{Body: []byte("second"), XRabtapReplyIf: "r.count == 1"}),
+	}}
+	var stats respondStats
+	var pending sync.WaitGroup
+	sink := newRespondMessageSink(context.Background(), publishCh, cmd, &stats, &pending, slog.New(slog.DiscardHandler))
+
+	require.NoError(t, sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{}}))
+	require.NoError(t, sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{ReplyTo: "reply-queue"}}))
+
+	message := <-publishCh
+	assert.Equal(t, []byte("second"), message.Publishing.Body)
+	assert.Equal(t, int64(2), stats.received)
+}
+
+func TestRespondMessageSinkDoesNotBlockOnDelayedReplies(t *testing.T) {
+	publishCh := make(rabtap.PublishChannel, 1)
+	cmd := CmdRespondArg{
+		replies: []recordedReply{mustNewRecordedReply(t, RabtapPersistentMessage{})},
+		delay:   time.Hour,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var stats respondStats
+	var pending sync.WaitGroup
+	sink := newRespondMessageSink(ctx, publishCh, cmd, &stats, &pending, slog.New(slog.DiscardHandler))
+
+	for range 3 {
+		require.NoError(t, sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{ReplyTo: "reply-queue"}}))
+	}
+	cancel()
+	pending.Wait()
+
+	assert.Empty(t, publishCh)
+	assert.Equal(t, int64(3), stats.received)
+	assert.Equal(t, int64(0), stats.replied.Load())
+}
+
+func TestRespondMessageSinkIgnoresUnmatchedRequestsAndRequestsWithoutReplyTo(t *testing.T) {
+	publishCh := make(rabtap.PublishChannel, 1)
+	cmd := CmdRespondArg{replies: []recordedReply{
+		mustNewRecordedReply(t, RabtapPersistentMessage{XRabtapReplyIf: "r.msg.Type == 'a'"}),
+	}}
+	var stats respondStats
+	var pending sync.WaitGroup
+	sink := newRespondMessageSink(context.Background(), publishCh, cmd, &stats, &pending, slog.New(slog.DiscardHandler))
+
+	require.NoError(t, sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{Type: "b", ReplyTo: "reply-queue"}}))
+	require.NoError(t, sink(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{Type: "a"}}))
+
+	assert.Empty(t, publishCh)
+	assert.Equal(t, int64(1), stats.unmatched)
+	assert.Equal(t, int64(1), stats.noReplyTo)
+}
+
+func TestIntegrationCmdRespondAnswersRequest(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	const requestQueue = "respond-queue-test"
+
+	tlsConfig := &tls.Config{}
+	amqpURL := testcommon.IntegrationURIFromEnv()
+	err := cmdQueueCreate(CmdQueueCreateArg{
+		amqpURL:   amqpURL,
+		queue:     requestQueue,
+		tlsConfig: tlsConfig,
+	}, logger)
+	require.NoError(t, err)
+	defer func() { _ = cmdQueueRemove(amqpURL, requestQueue, tlsConfig, logger) }()
+
+	dir := t.TempDir()
+	saveReplies(t, dir,
+		RabtapPersistentMessage{Body: []byte("pong"), XRabtapReplyIf: "r.toStr(r.msg.Body) == 'ping'"},
+		RabtapPersistentMessage{Body: []byte("unknown request")})
+
+	setup, err := testcommon.IntegrationTestConnection("", "", 0, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	// request must be sent after the rabtap respond command is started
+	replyCh := make(chan *amqp.Delivery, 1)
+	go func() {
+		time.Sleep(2 * time.Second)
+		reply, err := rabtap.Call(context.Background(), rabtap.Session{Connection: setup.Conn, Channel: setup.Chan},
+			rabtap.RPCConfig{Timeout: 5 * time.Second},
+			rabtap.NewRouting("", requestQueue, amqp.Table{}),
+			amqp.Publishing{Body: []byte("ping")})
+		assert.NoError(t, err)
+		replyCh <- reply
+	}()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = []string{
+		"rabtap", "respond", requestQueue,
+		"--uri", amqpURL.String(),
+		"--replies", dir,
+		"--format=json",
+		"--limit=1",
+	}
+
+	output := testcommon.CaptureOutput(rabtapMain)
+
+	assert.Contains(t, output, "replied to 1 requests")
+	reply := <-replyCh
+	require.NotNil(t, reply)
+	assert.Equal(t, []byte("pong"), reply.Body)
+}
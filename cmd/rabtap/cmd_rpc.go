@@ -0,0 +1,59 @@
+// rpc - send a request and wait for the reply
+// Copyright (C) 2026 Jan Delgado
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// CmdRPCArg contains the arguments for the rpc command
+type CmdRPCArg struct {
+	amqpURL        *url.URL
+	tlsConfig      *tls.Config
+	exchange       *string
+	routingKey     *string
+	headers        rabtap.KeyValueMap
+	source         MessageSource // provides the request, only the first message is sent
+	tempReplyQueue bool          // use a temporary queue instead of direct reply-to
+	timeout        time.Duration
+	messageSink    MessageSink // receives the reply
+}
+
+// cmdRPC publishes a request read from the source and passes the reply with
+// the matching correlation id to the message sink. Request and reply share
+// the same channel, as required by direct reply-to. Returns an error wrapping
+// rabtap.ErrReplyTimeout when no reply was received in time.
+func cmdRPC(ctx context.Context, cmd CmdRPCArg, logger *slog.Logger) error {
+	msg, err := cmd.source()
+	if errors.Is(err, io.EOF) {
+		return errors.New("no request message found")
+	}
+	if err != nil {
+		return fmt.Errorf("read request: %w", err)
+	}
+	routing := routingFromMessage(cmd.exchange, cmd.routingKey, cmd.headers, msg)
+
+	return rabtap.SimpleAmqpConnector(cmd.amqpURL,
+		cmd.tlsConfig,
+		func(session rabtap.Session) error {
+			logger.Debug("sending request", "routing", routing, "timeout", cmd.timeout)
+			reply, err := rabtap.Call(ctx, session,
+				rabtap.RPCConfig{TempReplyQueue: cmd.tempReplyQueue, Timeout: cmd.timeout},
+				routing, msg.ToAmqpPublishing())
+			if err != nil {
+				return fmt.Errorf("request to %s: %w", routing, err)
+			}
+			logger.Debug("received reply", "correlation_id", reply.CorrelationId)
+			return cmd.messageSink(rabtap.NewTapMessage(reply, time.Now()))
+		})
+}
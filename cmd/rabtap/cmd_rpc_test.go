@@ -0,0 +1,84 @@
+// Copyright (C) 2026 Jan Delgado
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jandelgado/rabtap/pkg/testcommon"
+)
+
+func TestCmdRPCFailsWithoutRequest(t *testing.T) {
+	err := cmdRPC(context.Background(), CmdRPCArg{
+		source: func() (RabtapPersistentMessage, error) { return RabtapPersistentMessage{}, io.EOF },
+	}, slog.New(slog.DiscardHandler))
+
+	assert.ErrorContains(t, err, "no request message found")
+}
+
+func TestIntegrationCmdRPCPrintsReply(t *testing.T) {
+	setup, err := testcommon.IntegrationTestConnection("rpc-exchange", "direct", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+	key := setup.QueueName(0)
+
+	requests, err := setup.Chan.Consume(key, "", true, false, false, false, nil)
+	require.NoError(t, err)
+	go func() {
+		request := <-requests
+		err := setup.Chan.Publish("", request.ReplyTo, false, false, amqp.Publishing{
+			CorrelationId: request.CorrelationId,
+			ContentType:   "text/plain",
+			Body:          []byte("pong"),
+		})
+		assert.NoError(t, err)
+	}()
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	request, err := os.CreateTemp(t.TempDir(), "request")
+	require.NoError(t, err)
+	_, err = request.WriteString("ping")
+	require.NoError(t, err)
+	require.NoError(t, request.Close())
+
+	os.Args = []string{"rabtap", "rpc", request.Name(),
+		"--uri", testcommon.IntegrationURIFromEnv().String(),
+		"--exchange=rpc-exchange", "--routingkey=" + key, "--no-color"}
+	output := testcommon.CaptureOutput(rabtapMain)
+
+	assert.Contains(t, output, "pong")
+}
+
+func TestIntegrationCmdRPCExitsWithTimeoutCode(t *testing.T) {
+	// rabtapMain exits the process, so run the command in a sub-process. The
+	// request is routed to a queue without consumer.
+	if key := os.Getenv("RABTAP_RPC_TIMEOUT_TEST_KEY"); key != "" {
+		os.Args = []string{"rabtap", "rpc", os.DevNull,
+			"--uri", testcommon.IntegrationURIFromEnv().String(),
+			"--exchange=rpc-exchange", "--routingkey=" + key, "--timeout=100ms"}
+		rabtapMain(os.Stdout)
+		return
+	}
+	setup, err := testcommon.IntegrationTestConnection("rpc-exchange", "direct", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestIntegrationCmdRPCExitsWithTimeoutCode$")
+	cmd.Env = append(os.Environ(), "RABTAP_RPC_TIMEOUT_TEST_KEY="+setup.QueueName(0))
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, exitCodeTimeout, exitErr.ExitCode())
+}
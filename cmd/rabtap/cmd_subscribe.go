@@ -28,33 +28,80 @@ type CmdSubscribeArg struct {
 	requeue     bool
 	args        rabtap.KeyValueMap
 	timeout     time.Duration
+	prefetch    int           // optional, number of unacknowledged messages
+	ackBatch    int           // optional, acknowledge messages in batches of ackBatch
+	ackMode     AckMode       // when messages are acknowledged
+	drain       bool          // stop after all messages in the queue were received once
+	ackInterval time.Duration // max time messages of a batch are unacknowledged
 }
 
-// cmdSub subscribes to messages from the given queue
+// cmdSub subscribes to messages from the given queue. The ackMode controls
+// when messages are acknowledged. When ackBatch is set, messages are
+// acknowledged in batches, which are flushed before the subscription ends.
+// When drain is set, the subscription ends after all messages, which were in
+// the queue at the start, were received once.
 func cmdSubscribe(ctx context.Context, cmd CmdSubscribeArg, logger *slog.Logger) error {
+	termPred := cmd.termPred
+	if cmd.drain {
+		var numMessages int
+		err := rabtap.SimpleAmqpConnector(cmd.amqpURL, cmd.tlsConfig,
+			func(session rabtap.Session) (err error) {
+				numMessages, err = rabtap.QueueMessageCount(session, cmd.queue)
+				return err
+			})
+		if err != nil {
+			return fmt.Errorf("subscribe failed: %w", err)
+		}
+		logger.Info("draining queue", "queue", cmd.queue, "messages", numMessages)
+		if numMessages == 0 {
+			return nil
+		}
+		termPred = AnyPredicate{termPred, &ReceivedCountPred{int64(numMessages)}}
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	g, ctx := errgroup.WithContext(ctx)
 
+	// the subscription must outlive the message loop, so that pending
+	// acknowledgements can be flushed when the loop ends
+	subCtx, subCancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer subCancel()
+
 	config := rabtap.AmqpSubscriberConfig{
-		Exclusive: false,
-		Args:      rabtap.ToAMQPTable(cmd.args),
+		Exclusive:     false,
+		Args:          rabtap.ToAMQPTable(cmd.args),
+		PrefetchCount: cmd.prefetch,
 	}
 	subscriber := rabtap.NewAmqpSubscriber(config, cmd.amqpURL, cmd.tlsConfig, logger)
 
 	messageChannel := make(rabtap.TapChannel)
 	errorChannel := make(rabtap.SubscribeErrorChannel)
-	g.Go(func() error { return subscriber.EstablishSubscription(ctx, cmd.queue, messageChannel, errorChannel) })
 	g.Go(func() error {
+		err := subscriber.EstablishSubscription(subCtx, cmd.queue, messageChannel, errorChannel)
+		cancel()
+		return err
+	})
+	g.Go(func() error {
+		defer subCancel()
 		acknowledger := CreateAcknowledgeFunc(cmd.reject, cmd.requeue)
+		flush := func() error { return nil }
+		if cmd.ackBatch > 1 {
+			batch := NewBatchAcknowledger(cmd.reject, cmd.requeue, cmd.ackBatch, cmd.ackInterval, logger)
+			acknowledger, flush = batch.Acknowledge, batch.Flush
+		}
 		err := MessageReceiveLoop(ctx,
 			messageChannel,
 			errorChannel,
 			cmd.messageSink,
 			cmd.filterPred,
-			cmd.termPred,
+			termPred,
 			acknowledger,
+			cmd.ackMode,
 			cmd.timeout,
 			logger)
+		if err := flush(); err != nil {
+			logger.Error("acknowledge pending messages failed", "error", err)
+		}
 		cancel()
 		return err
 	})
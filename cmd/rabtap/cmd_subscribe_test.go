@@ -110,6 +110,7 @@ func TestCmdSub(t *testing.T) {
 			routingKey: &testKey,
 			headers:    rabtap.KeyValueMap{},
 			tlsConfig:  tlsConfig,
+			out:        io.Discard,
 			source: func() (RabtapPersistentMessage, error) {
 				// provide exactly one message
 				if messageCount > 0 {
@@ -185,3 +186,93 @@ func TestCmdSubIntegration(t *testing.T) {
 	// then
 	assert.Regexp(t, "(?s).*message received.*\nroutingkey.....: sub-queue-test\n.*Hello", output)
 }
+
+func TestCmdSubWithBatchedAcksAcknowledgesAllMessagesOnLimit(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	const testQueue = "sub-queue-batch-test"
+	const numMessages = 10
+
+	tlsConfig := &tls.Config{}
+	amqpURL := testcommon.IntegrationURIFromEnv()
+
+	err := cmdQueueCreate(CmdQueueCreateArg{
+		amqpURL:   amqpURL,
+		queue:     testQueue,
+		durable:   true,
+		tlsConfig: tlsConfig,
+	}, logger)
+	require.NoError(t, err)
+	defer func() { _ = cmdQueueRemove(amqpURL, testQueue, tlsConfig, logger) }()
+
+	setup, err := testcommon.IntegrationTestConnection("", "", 0, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+	for i := 0; i < numMessages; i++ {
+		err = setup.Chan.Publish("", testQueue, false, false,
+			amqp.Publishing{Body: []byte("Hello"), ContentType: "text/plain"})
+		require.Nil(t, err)
+	}
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = []string{
+		"rabtap", "sub",
+		"--uri", amqpURL.String(),
+		testQueue,
+		"--limit=10",
+		"--ack-batch=4",
+		"--silent",
+	}
+
+	// when
+	_ = testcommon.CaptureOutput(rabtapMain)
+
+	// then all messages, including the last incomplete batch, are acknowledged
+	queue, err := setup.Chan.QueueDeclarePassive(testQueue, true, false, false, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, queue.Messages)
+}
+
+func TestCmdSubWithAckIfDrainsOnlyMatchingMessages(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	const testQueue = "sub-queue-ack-if-test"
+
+	tlsConfig := &tls.Config{}
+	amqpURL := testcommon.IntegrationURIFromEnv()
+
+	err := cmdQueueCreate(CmdQueueCreateArg{
+		amqpURL:   amqpURL,
+		queue:     testQueue,
+		durable:   true,
+		tlsConfig: tlsConfig,
+	}, logger)
+	require.NoError(t, err)
+	defer func() { _ = cmdQueueRemove(amqpURL, testQueue, tlsConfig, logger) }()
+
+	setup, err := testcommon.IntegrationTestConnection("", "", 0, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+	for _, typ := range []string{"good", "bad", "good", "bad", "good"} {
+		err = setup.Chan.Publish("", testQueue, false, false,
+			amqp.Publishing{Body: []byte("Hello"), Type: typ})
+		require.Nil(t, err)
+	}
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = []string{
+		"rabtap", "sub",
+		"--uri", amqpURL.String(),
+		testQueue,
+		"--ack-if=r.msg.Type == 'bad'",
+		"--silent",
+	}
+
+	// when
+	_ = testcommon.CaptureOutput(rabtapMain)
+
+	// then only the non-matching messages are left in the queue
+	queue, err := setup.Chan.QueueDeclarePassive(testQueue, true, false, false, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, queue.Messages)
+}
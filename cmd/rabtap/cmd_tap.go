@@ -8,6 +8,9 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -16,44 +19,300 @@ import (
 )
 
 type CmdTapArg struct {
-	tapConfig   []rabtap.TapConfiguration
-	tlsConfig   *tls.Config
-	messageSink MessageSink
-	termPred    Predicate
-	filterPred  Predicate
-	timeout     time.Duration
+	tapConfig      []rabtap.TapConfiguration
+	apiClient      *rabtap.RabbitHTTPClient // optional, used to discover bindings
+	exchangeFilter Predicate                // optional, tap all exchanges passing the filter
+	rescanInterval time.Duration            // optional, rescan for new exchanges to tap
+	firehose       bool                     // tap the firehose, tracing is enabled using the API
+	dedupWindow    time.Duration            // optional, suppress duplicates received within window
+	tapSetup       rabtap.AmqpTapConfig     // naming of tap resources or pre-provisioned queue
+	tlsConfig      *tls.Config
+	messageSink    MessageSink
+	termPred       Predicate
+	filterPred     Predicate
+	timeout        time.Duration
+}
+
+// TapStarter starts tapping the given exchanges on the given broker
+type TapStarter func(amqpURL *url.URL, exchanges []rabtap.ExchangeConfiguration)
+
+// discoverBindings replaces exchanges without binding key in the given tap
+// configurations with the binding keys discovered using the management API.
+func discoverBindings(ctx context.Context,
+	apiClient *rabtap.RabbitHTTPClient,
+	tapConfigs []rabtap.TapConfiguration,
+	logger *slog.Logger,
+) ([]rabtap.TapConfiguration, error) {
+	result := make([]rabtap.TapConfiguration, 0, len(tapConfigs))
+	for _, config := range tapConfigs {
+		if !config.NeedsBindingDiscovery() {
+			result = append(result, config)
+			continue
+		}
+		if apiClient == nil {
+			return nil, fmt.Errorf("no binding key given but --api omitted and RABTAP_APIURI not set")
+		}
+		vhost, err := rabtap.VhostFromURL(config.AMQPURL)
+		if err != nil {
+			return nil, err
+		}
+		exchanges, err := rabtap.DiscoverExchangeConfigurations(ctx, apiClient, vhost, config.Exchanges)
+		if err != nil {
+			return nil, err
+		}
+		logger.Debug("discovered bindings", "vhost", vhost, "exchanges", exchanges)
+		result = append(result, rabtap.TapConfiguration{AMQPURL: config.AMQPURL, Exchanges: exchanges})
+	}
+	return result, nil
+}
+
+// tapMatchingExchanges taps all exchanges of the vhost of the given broker
+// passing the exchange filter of the tap command. When a rescan interval is
+// set, the exchanges are periodically rediscovered and new exchanges are
+// tapped.
+func tapMatchingExchanges(ctx context.Context,
+	cmd CmdTapArg,
+	amqpURL *url.URL,
+	startTap TapStarter,
+	logger *slog.Logger,
+) error {
+	if cmd.apiClient == nil {
+		return fmt.Errorf("--api omitted but RABTAP_APIURI not set in environment")
+	}
+	vhost, err := rabtap.VhostFromURL(amqpURL)
+	if err != nil {
+		return err
+	}
+	filter := func(exchange rabtap.RabbitExchange) (bool, error) {
+		// never tap the exchanges created by other taps
+		if cmd.tapSetup.NamePrefix != "" && strings.HasPrefix(exchange.Name, cmd.tapSetup.NamePrefix) {
+			return false, nil
+		}
+		return cmd.exchangeFilter.Eval(map[string]interface{}{"exchange": exchange})
+	}
+
+	type binding struct{ exchange, key string }
+	tapped := map[binding]bool{}
+	for scan := 0; ; scan++ {
+		exchanges, err := rabtap.DiscoverExchanges(ctx, cmd.apiClient, vhost, filter)
+		switch {
+		case err != nil && scan == 0:
+			return fmt.Errorf("discover exchanges: %w", err)
+		case err != nil:
+			logger.Error("rescan for exchanges failed", "error", err)
+		case len(exchanges) == 0 && scan == 0 && cmd.rescanInterval == 0:
+			return fmt.Errorf("no exchanges to tap found on vhost %s", vhost)
+		}
+
+		var newExchanges []rabtap.ExchangeConfiguration
+		for _, exchange := range exchanges {
+			b := binding{exchange.Exchange, exchange.BindingKey}
+			if !tapped[b] {
+				tapped[b] = true
+				newExchanges = append(newExchanges, exchange)
+			}
+		}
+		if len(newExchanges) > 0 {
+			logger.Info("tapping exchanges", "vhost", vhost, "exchanges", newExchanges)
+			startTap(amqpURL, newExchanges)
+		}
+
+		if cmd.rescanInterval == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(cmd.rescanInterval):
+		}
+	}
+}
+
+// enableTracing enables the FireHose tracer on the given vhost, if not already
+// enabled. The returned function restores the previous state of the tracer.
+func enableTracing(ctx context.Context,
+	apiClient *rabtap.RabbitHTTPClient,
+	vhost string,
+	logger *slog.Logger,
+) (func(), error) {
+	vhosts, err := apiClient.Vhosts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get vhosts: %w", err)
+	}
+	idx := slices.IndexFunc(vhosts, func(v rabtap.RabbitVhost) bool { return v.Name == vhost })
+	if idx < 0 {
+		return nil, fmt.Errorf("vhost %s not found", vhost)
+	}
+	if vhosts[idx].Tracing {
+		logger.Info("tracing already enabled", "vhost", vhost)
+		return func() {}, nil
+	}
+	if err := apiClient.SetTracing(ctx, vhost, true); err != nil {
+		return nil, fmt.Errorf("enable tracing on vhost %s: %w", vhost, err)
+	}
+	logger.Info("tracing enabled", "vhost", vhost)
+	return func() {
+		// ctx is likely already cancelled when the tap ends
+		ctx, cancel := context.WithTimeout(context.Background(), rabtap.HTTP_DEFAULT_TIMEOUT)
+		defer cancel()
+		if err := apiClient.SetTracing(ctx, vhost, false); err != nil {
+			logger.Error("disable tracing failed", "vhost", vhost, "error", err)
+			return
+		}
+		logger.Info("tracing disabled", "vhost", vhost)
+	}, nil
+}
+
+// decodeFireHoseMessages decodes the messages received from the FireHose
+// exchange and passes the original messages on to the returned channel.
+// Messages that can not be decoded are passed on as-is.
+func decodeFireHoseMessages(ctx context.Context, in rabtap.TapChannel, logger *slog.Logger) rabtap.TapChannel {
+	out := make(rabtap.TapChannel)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, more := <-in:
+				if !more {
+					close(out)
+					return
+				}
+				if rabtap.IsFireHoseMessage(message) {
+					decoded, err := rabtap.DecodeFireHoseMessage(message)
+					if err != nil {
+						logger.Error("decoding firehose message failed", "error", err)
+					} else {
+						message = decoded
+					}
+				}
+				select {
+				case out <- message:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// droppedMessages returns the number of messages dropped from the given
+// queue, due to a length limit or an expired TTL, i.e. messages routed to the
+// queue, that were neither delivered nor are still in the queue. Since the
+// statistics are collected periodically by the broker, this is an estimate.
+func droppedMessages(queue rabtap.RabbitQueue) int {
+	return max(0, queue.MessageStats.Publish-queue.MessageStats.DeliverGet-queue.MessagesReady)
+}
+
+// reportDroppedMessages logs the number of messages dropped from the given
+// tap queues, using the management API.
+func reportDroppedMessages(apiClient *rabtap.RabbitHTTPClient,
+	vhost string,
+	queues []string,
+	logger *slog.Logger,
+) {
+	// ctx of the tap is already cancelled on teardown
+	ctx, cancel := context.WithTimeout(context.Background(), rabtap.HTTP_DEFAULT_TIMEOUT)
+	defer cancel()
+	for _, name := range queues {
+		queue, err := apiClient.Queue(ctx, vhost, name)
+		if err != nil {
+			logger.Error("get tap queue statistics failed", "queue", name, "error", err)
+			continue
+		}
+		if dropped := droppedMessages(queue); dropped > 0 {
+			logger.Warn("messages dropped from tap queue", "queue", name, "dropped", dropped)
+		} else {
+			logger.Info("no messages dropped from tap queue", "queue", name)
+		}
+	}
 }
 
 // cmdTap taps to the given exchanges and displays or saves the received
-// messages.
-// TODO feature: discover bindings when no binding keys are given (-> discovery.go)
+// messages. Exchanges given without binding key are tapped using the
+// binding keys discovered with the management API. When an exchange filter
+// is set, all exchanges passing the filter are tapped. In firehose mode, the
+// tracer is enabled during the tap and the traced messages are decoded. When a
+// dedup window is set, duplicates received through overlapping taps are
+// suppressed.
 func cmdTap(
 	ctx context.Context,
 	cmd CmdTapArg,
 	logger *slog.Logger,
 ) error {
+	tapConfigs, err := discoverBindings(ctx, cmd.apiClient, cmd.tapConfig, logger)
+	if err != nil {
+		return fmt.Errorf("tap failed with: %w", err)
+	}
+
+	if cmd.apiClient == nil && cmd.tapSetup.IsBounded() {
+		logger.Warn("tap queues are bounded, but no management API is configured (see --api). Dropped messages will not be reported.")
+	}
+
+	if cmd.firehose {
+		for _, config := range tapConfigs {
+			vhost, err := rabtap.VhostFromURL(config.AMQPURL)
+			if err != nil {
+				return fmt.Errorf("tap failed with: %w", err)
+			}
+			restore, err := enableTracing(ctx, cmd.apiClient, vhost, logger)
+			if err != nil {
+				return fmt.Errorf("tap failed with: %w", err)
+			}
+			defer restore()
+		}
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	g, ctx := errgroup.WithContext(ctx)
 
 	tapMessageChannel := make(rabtap.TapChannel)
 	errorChannel := make(rabtap.SubscribeErrorChannel)
 
-	for _, config := range cmd.tapConfig {
-		config := config
-		tap := rabtap.NewAmqpTap(config.AMQPURL, cmd.tlsConfig, logger)
+	startTap := func(amqpURL *url.URL, exchanges []rabtap.ExchangeConfiguration) {
+		tapSetup := cmd.tapSetup
+		if vhost, err := rabtap.VhostFromURL(amqpURL); err == nil &&
+			cmd.apiClient != nil && tapSetup.IsBounded() {
+			tapSetup.OnTeardown = func(queues []string) {
+				reportDroppedMessages(cmd.apiClient, vhost, queues, logger)
+			}
+		}
+		tap := rabtap.NewAmqpTap(tapSetup, amqpURL, cmd.tlsConfig, logger)
 		g.Go(func() error {
-			return tap.EstablishTap(ctx, config.Exchanges, tapMessageChannel, errorChannel)
+			return tap.EstablishTap(ctx, exchanges, tapMessageChannel, errorChannel)
 		})
 	}
+
+	for _, config := range tapConfigs {
+		config := config
+		if cmd.exchangeFilter != nil {
+			g.Go(func() error {
+				return tapMatchingExchanges(ctx, cmd, config.AMQPURL, startTap, logger)
+			})
+			continue
+		}
+		startTap(config.AMQPURL, config.Exchanges)
+	}
+	receiveChannel := tapMessageChannel
+	if cmd.firehose {
+		receiveChannel = decodeFireHoseMessages(ctx, receiveChannel, logger)
+	}
+	acknowledger := CreateAcknowledgeFunc(false, false) // ACK
+	if cmd.dedupWindow > 0 {
+		// messages are already acknowledged by the deduplication
+		receiveChannel = rabtap.DeduplicateMessages(ctx, receiveChannel, cmd.dedupWindow, logger)
+		acknowledger = func(rabtap.TapMessage) error { return nil }
+	}
 	g.Go(func() error {
-		acknowledger := CreateAcknowledgeFunc(false, false) // ACK
 		err := MessageReceiveLoop(ctx,
-			tapMessageChannel,
+			receiveChannel,
 			errorChannel,
 			cmd.messageSink,
 			cmd.filterPred,
 			cmd.termPred,
 			acknowledger,
+			AckOnReceive,
 			cmd.timeout,
 			logger)
 		cancel()
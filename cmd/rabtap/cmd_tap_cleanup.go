@@ -0,0 +1,215 @@
+// cmd_tap_cleanup - remove orphaned tap exchanges and queues
+// Copyright (C) 2026 Jan Delgado
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+type CmdTapCleanupArg struct {
+	apiClient  *rabtap.RabbitHTTPClient
+	vhost      string               // optional, only clean up the given vhost
+	naming     rabtap.AmqpTapConfig // prefix and name template of the tap exchanges and queues
+	minIdle    time.Duration        // min. time a tap queue must be idle to be removed
+	settleTime time.Duration        // time after which orphaned exchanges are checked again
+	dryRun     bool                 // only show orphaned resources, do not delete them
+	out        io.Writer
+}
+
+// idleSinceLayouts are the formats of the idle_since field of queues, which
+// differ between RabbitMQ versions
+var idleSinceLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05"}
+
+// queueIdleTime returns for how long the given queue is idle. Returns false,
+// if the queue is not idle or the idle time is unknown.
+func queueIdleTime(queue rabtap.RabbitQueue, now time.Time) (time.Duration, bool) {
+	for _, layout := range idleSinceLayouts {
+		if since, err := time.Parse(layout, queue.IdleSince); err == nil {
+			return now.Sub(since), true
+		}
+	}
+	return 0, false
+}
+
+// tapID returns the unique id contained in the name of a tap exchange or
+// queue matching the given pattern, or "" if the name contains no id.
+func tapID(pattern *regexp.Regexp, name string) string {
+	i := pattern.SubexpIndex("id")
+	match := pattern.FindStringSubmatch(name)
+	if i < 0 || match == nil {
+		return ""
+	}
+	return match[i]
+}
+
+// findOrphanedTapResources returns the tap exchanges and queues, which are no
+// longer in use by a tap: tap queues without consumers, which are idle for at
+// least minIdle, and tap exchanges neither bound to a queue in use nor
+// belonging to a tap queue in use, i.e. having the same id. Tap exchanges and
+// queues are identified by their names matching the given patterns. If vhost
+// is not empty, only resources of the given vhost are returned.
+//
+// Requiring a minimum idle time keeps taps which are just being set up, i.e.
+// whose queue is declared, but not yet consumed.
+func findOrphanedTapResources(
+	exchanges []rabtap.RabbitExchange,
+	queues []rabtap.RabbitQueue,
+	bindings []rabtap.RabbitBinding,
+	vhost string,
+	exchangePattern, queuePattern *regexp.Regexp,
+	minIdle time.Duration,
+	now time.Time,
+) ([]rabtap.RabbitExchange, []rabtap.RabbitQueue) {
+	type resource struct{ vhost, name string }
+
+	inVhost := func(resVhost string) bool {
+		return vhost == "" || resVhost == vhost
+	}
+
+	queueInUse := map[resource]bool{}
+	tapInUse := map[resource]bool{} // vhost and id of taps in use
+	var orphanedQueues []rabtap.RabbitQueue
+	for _, queue := range queues {
+		idle, isIdle := queueIdleTime(queue, now)
+		if queue.Consumers > 0 || !isIdle || idle < minIdle {
+			queueInUse[resource{queue.Vhost, queue.Name}] = true
+			if id := tapID(queuePattern, queue.Name); id != "" {
+				tapInUse[resource{queue.Vhost, id}] = true
+			}
+		} else if inVhost(queue.Vhost) && queuePattern.MatchString(queue.Name) {
+			orphanedQueues = append(orphanedQueues, queue)
+		}
+	}
+
+	exchangeInUse := map[resource]bool{}
+	for _, binding := range bindings {
+		if binding.DestinationType == "queue" && queueInUse[resource{binding.Vhost, binding.Destination}] {
+			exchangeInUse[resource{binding.Vhost, binding.Source}] = true
+		}
+	}
+	var orphanedExchanges []rabtap.RabbitExchange
+	for _, exchange := range exchanges {
+		if !inVhost(exchange.Vhost) || !exchangePattern.MatchString(exchange.Name) ||
+			exchangeInUse[resource{exchange.Vhost, exchange.Name}] {
+			continue
+		}
+		if id := tapID(exchangePattern, exchange.Name); id != "" && tapInUse[resource{exchange.Vhost, id}] {
+			continue
+		}
+		orphanedExchanges = append(orphanedExchanges, exchange)
+	}
+	return orphanedExchanges, orphanedQueues
+}
+
+// stillOrphaned returns the resources of before, which are also contained in
+// after, identified by the vhost and name returned by key.
+func stillOrphaned[T any](before, after []T, key func(T) [2]string) []T {
+	found := map[[2]string]bool{}
+	for _, res := range after {
+		found[key(res)] = true
+	}
+	var result []T
+	for _, res := range before {
+		if found[key(res)] {
+			result = append(result, res)
+		}
+	}
+	return result
+}
+
+// cmdTapCleanup finds orphaned tap exchanges and queues, e.g. left over
+// after a crash of rabtap, using the management API, shows and deletes them.
+// Orphaned tap exchanges are looked up twice, settleTime apart, to not delete
+// the exchanges of taps being set up.
+func cmdTapCleanup(ctx context.Context, cmd CmdTapCleanupArg, logger *slog.Logger) error {
+	exchangePattern, err := cmd.naming.TapNamePattern("exchange")
+	if err != nil {
+		return err
+	}
+	queuePattern, err := cmd.naming.TapNamePattern("queue")
+	if err != nil {
+		return err
+	}
+
+	find := func() ([]rabtap.RabbitExchange, []rabtap.RabbitQueue, error) {
+		exchanges, err := cmd.apiClient.Exchanges(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get exchanges: %w", err)
+		}
+		queues, err := cmd.apiClient.Queues(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get queues: %w", err)
+		}
+		bindings, err := cmd.apiClient.Bindings(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get bindings: %w", err)
+		}
+		exchanges, queues = findOrphanedTapResources(
+			exchanges, queues, bindings, cmd.vhost, exchangePattern, queuePattern,
+			cmd.minIdle, time.Now())
+		return exchanges, queues, nil
+	}
+
+	orphanedExchanges, orphanedQueues, err := find()
+	if err != nil {
+		return err
+	}
+	if len(orphanedExchanges) > 0 && cmd.settleTime > 0 {
+		// exchanges have no idle time. The exchange of a tap being set up is
+		// only briefly without a queue, so an exchange is only orphaned, when
+		// it is still orphaned after the settle time.
+		logger.Debug("waiting to check orphaned tap exchanges again", "settle_time", cmd.settleTime)
+		select {
+		case <-time.After(cmd.settleTime):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		exchanges, queues, err := find()
+		if err != nil {
+			return err
+		}
+		orphanedExchanges = stillOrphaned(orphanedExchanges, exchanges,
+			func(e rabtap.RabbitExchange) [2]string { return [2]string{e.Vhost, e.Name} })
+		orphanedQueues = stillOrphaned(orphanedQueues, queues,
+			func(q rabtap.RabbitQueue) [2]string { return [2]string{q.Vhost, q.Name} })
+	}
+	logger.Debug("found orphaned tap resources",
+		"exchanges", len(orphanedExchanges), "queues", len(orphanedQueues))
+
+	action := "deleted"
+	if cmd.dryRun {
+		action = "would delete"
+	}
+
+	// exchanges are deleted first, since deleting the queues may trigger
+	// the auto-deletion of the exchanges
+	var errs []error
+	for _, exchange := range orphanedExchanges {
+		if !cmd.dryRun {
+			if err := cmd.apiClient.DeleteExchange(ctx, exchange.Vhost, exchange.Name); err != nil {
+				errs = append(errs, fmt.Errorf("delete exchange %s: %w", exchange.Name, err))
+				continue
+			}
+		}
+		_, _ = fmt.Fprintf(cmd.out, "%s exchange %s on vhost %s\n", action, exchange.Name, exchange.Vhost)
+	}
+	for _, queue := range orphanedQueues {
+		if !cmd.dryRun {
+			if err := cmd.apiClient.DeleteQueue(ctx, queue.Vhost, queue.Name); err != nil {
+				errs = append(errs, fmt.Errorf("delete queue %s: %w", queue.Name, err))
+				continue
+			}
+		}
+		_, _ = fmt.Fprintf(cmd.out, "%s queue %s on vhost %s\n", action, queue.Name, queue.Vhost)
+	}
+	return errors.Join(errs...)
+}
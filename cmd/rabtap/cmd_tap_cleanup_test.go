@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/jandelgado/rabtap/pkg/testcommon"
+)
+
+func findOrphanedDefaultTapResources(
+	t *testing.T,
+	exchanges []rabtap.RabbitExchange,
+	queues []rabtap.RabbitQueue,
+	bindings []rabtap.RabbitBinding,
+	vhost string,
+	now time.Time,
+) ([]rabtap.RabbitExchange, []rabtap.RabbitQueue) {
+	exchangePattern, err := rabtap.AmqpTapConfig{}.TapNamePattern("exchange")
+	require.NoError(t, err)
+	queuePattern, err := rabtap.AmqpTapConfig{}.TapNamePattern("queue")
+	require.NoError(t, err)
+	return findOrphanedTapResources(exchanges, queues, bindings, vhost,
+		exchangePattern, queuePattern, time.Minute, now)
+}
+
+func TestFindOrphanedTapResourcesFindsUnusedTapExchangesAndQueues(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	longIdle := "2026-01-01 11:00:00"
+	exchanges := []rabtap.RabbitExchange{
+		{Name: "__tap-exchange-for-x-000000000001", Vhost: "/"},   // in use
+		{Name: "__tap-exchange-for-x-000000000002", Vhost: "/"},   // bound queue without consumer
+		{Name: "__tap-exchange-for-x-000000000003", Vhost: "/"},   // no bindings
+		{Name: "__tap-exchange-for-x-000000000004", Vhost: "vh2"}, // other vhost
+		{Name: "__tap-exchange-for-x-000000000006", Vhost: "/"},   // queue being set up, not yet bound
+		{Name: "__tap-exchange-for-x", Vhost: "/"},                // not a tap name
+		{Name: "amq.topic", Vhost: "/"},
+	}
+	queues := []rabtap.RabbitQueue{
+		{Name: "__tap-queue-for-x-000000000001", Vhost: "/", Consumers: 1, IdleSince: longIdle},
+		{Name: "__tap-queue-for-x-000000000002", Vhost: "/", Consumers: 0, IdleSince: longIdle},
+		{Name: "__tap-queue-for-x-000000000004", Vhost: "vh2", Consumers: 0, IdleSince: "2026-01-01T11:00:00.000+00:00"},
+		{Name: "__tap-queue-for-x-000000000005", Vhost: "/", Consumers: 0, IdleSince: longIdle}, // not bound
+		{Name: "__tap-queue-for-x-000000000006", Vhost: "/", Consumers: 0, IdleSince: "2026-01-01 11:59:58"},
+		{Name: "__tap-queue-for-x-000000000007", Vhost: "/", Consumers: 0}, // running
+		{Name: "other", Vhost: "/", Consumers: 0, IdleSince: longIdle},
+	}
+	bindings := []rabtap.RabbitBinding{
+		{Source: "__tap-exchange-for-x-000000000001", Vhost: "/", Destination: "__tap-queue-for-x-000000000001", DestinationType: "queue"},
+		{Source: "__tap-exchange-for-x-000000000002", Vhost: "/", Destination: "__tap-queue-for-x-000000000002", DestinationType: "queue"},
+		{Source: "__tap-exchange-for-x-000000000004", Vhost: "vh2", Destination: "__tap-queue-for-x-000000000004", DestinationType: "queue"},
+		{Source: "amq.topic", Vhost: "/", Destination: "__tap-exchange-for-x-000000000001", DestinationType: "exchange"},
+		{Source: "amq.topic", Vhost: "/", Destination: "other", DestinationType: "queue"},
+	}
+
+	orphanedExchanges, orphanedQueues := findOrphanedDefaultTapResources(t, exchanges, queues, bindings, "/", now)
+
+	assert.Equal(t, []rabtap.RabbitExchange{exchanges[1], exchanges[2]}, orphanedExchanges)
+	assert.Equal(t, []rabtap.RabbitQueue{queues[1], queues[3]}, orphanedQueues)
+
+	orphanedExchanges, orphanedQueues = findOrphanedDefaultTapResources(t, exchanges, queues, bindings, "", now)
+
+	assert.Equal(t, []rabtap.RabbitExchange{exchanges[1], exchanges[2], exchanges[3]}, orphanedExchanges)
+	assert.Equal(t, []rabtap.RabbitQueue{queues[1], queues[2], queues[3]}, orphanedQueues)
+}
+
+func TestQueueIdleTimeParsesIdleSince(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	idle, ok := queueIdleTime(rabtap.RabbitQueue{IdleSince: "2026-01-01 11:59:00"}, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, idle)
+
+	idle, ok = queueIdleTime(rabtap.RabbitQueue{IdleSince: "2026-01-01T12:59:00.000+01:00"}, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, idle)
+
+	_, ok = queueIdleTime(rabtap.RabbitQueue{}, now)
+	assert.False(t, ok)
+}
+
+func TestStillOrphanedKeepsOnlyResourcesOrphanedInBothChecks(t *testing.T) {
+	before := []rabtap.RabbitExchange{
+		{Name: "ex1", Vhost: "/"},
+		{Name: "ex2", Vhost: "/"},
+		{Name: "ex3", Vhost: "/"},
+	}
+	after := []rabtap.RabbitExchange{
+		{Name: "ex1", Vhost: "/"},
+		{Name: "ex3", Vhost: "other"},
+		{Name: "ex4", Vhost: "/"},
+	}
+
+	result := stillOrphaned(before, after,
+		func(e rabtap.RabbitExchange) [2]string { return [2]string{e.Vhost, e.Name} })
+
+	assert.Equal(t, []rabtap.RabbitExchange{{Name: "ex1", Vhost: "/"}}, result)
+}
+
+func runCmdTapCleanup(t *testing.T, naming rabtap.AmqpTapConfig, dryRun bool) (string, error) {
+	mock := testcommon.NewRabbitAPIMock(testcommon.MockModeStd)
+	defer mock.Close()
+	apiURL, _ := url.Parse(mock.URL)
+
+	var out bytes.Buffer
+	err := cmdTapCleanup(context.TODO(), CmdTapCleanupArg{
+		apiClient: rabtap.NewRabbitHTTPClient(apiURL, &tls.Config{}),
+		vhost:     "/",
+		naming:    naming,
+		minIdle:   time.Minute,
+		dryRun:    dryRun,
+		out:       &out,
+	}, slog.New(slog.DiscardHandler))
+	return out.String(), err
+}
+
+func TestCmdTapCleanupInDryRunModeOnlyShowsOrphanedResources(t *testing.T) {
+	// the mock has no tap resources, so we use templates matching its names
+	output, err := runCmdTapCleanup(t, rabtap.AmqpTapConfig{
+		NamePrefix: "test-", NameTemplate: "{{.Prefix}}{{.Exchange}}"}, true)
+
+	require.NoError(t, err)
+	assert.Equal(t, `would delete exchange test-fanout on vhost /
+would delete exchange test-headers on vhost /
+would delete exchange test-topic on vhost /
+`, output)
+}
+
+func TestCmdTapCleanupDeletesOrphanedResources(t *testing.T) {
+	output, err := runCmdTapCleanup(t, rabtap.AmqpTapConfig{
+		NamePrefix:   "fanout",
+		NameTemplate: `{{if eq .Kind "exchange"}}test-{{.Prefix}}{{else}}{{.Prefix}}-{{.Exchange}}{{end}}`,
+	}, false)
+
+	require.NoError(t, err)
+	assert.Equal(t, `deleted exchange test-fanout on vhost /
+deleted queue fanout-q1 on vhost /
+deleted queue fanout-q2 on vhost /
+`, output)
+}
+
+func TestCmdTapCleanupKeepsActiveQueues(t *testing.T) {
+	// direct-q1 has consumers, direct-q2 is not idle
+	output, err := runCmdTapCleanup(t, rabtap.AmqpTapConfig{
+		NamePrefix:   "direct",
+		NameTemplate: `{{if eq .Kind "exchange"}}test-{{.Prefix}}{{else}}{{.Prefix}}-{{.Exchange}}{{end}}`,
+	}, false)
+
+	require.NoError(t, err)
+	assert.Equal(t, "", output)
+}
+
+func TestCmdTapCleanupReportsFailedDeletions(t *testing.T) {
+	output, err := runCmdTapCleanup(t, rabtap.AmqpTapConfig{
+		NamePrefix:   "topic",
+		NameTemplate: `{{if eq .Kind "exchange"}}test-{{.Prefix}}{{else}}{{.Prefix}}-{{.Exchange}}{{end}}`,
+	}, false)
+
+	assert.ErrorContains(t, err, "delete queue topic-q1: 404 Not Found")
+	assert.ErrorContains(t, err, "delete queue topic-q2: 404 Not Found")
+	assert.Equal(t, "deleted exchange test-topic on vhost /\n", output)
+}
@@ -18,6 +18,7 @@ import (
 	"time"
 
 	docopt "github.com/docopt/docopt-go"
+	amqp "github.com/rabbitmq/amqp091-go"
 
 	rabtap "github.com/jandelgado/rabtap/pkg"
 )
@@ -41,16 +42,49 @@ const (
 Usage:
   rabtap info [--api=APIURI] [--consumers] [--stats] [--filter=EXPR] [--omit-empty]
               [--show-default] [--mode=MODE] [--format=FORMAT] [TLSOPTIONS] [COMMON OPTIONS]
-  rabtap tap EXCHANGES [--uri=URI] [--saveto=DIR] [--format=FORMAT|--json]  [--limit=NUM]
-              [--idle-timeout=DURATION] [--filter=EXPR] [--silent] [TLSOPTIONS] [COMMON OPTIONS]
-  rabtap (tap --uri=URI EXCHANGES)... [--saveto=DIR] [--format=FORMAT|--json]  [--limit=NUM]
-              [--idle-timeout=DURATION] [--filter=EXPR] [--silent] [TLSOPTIONS] [COMMON OPTIONS]
+  rabtap tap cleanup [--api=APIURI] [--vhost=VHOST] [--tap-prefix=PREFIX] [--dry-run]
+              [--tap-name-template=TEMPLATE] [--min-idle=DURATION] [TLSOPTIONS]
+              [COMMON OPTIONS]
+  rabtap tap EXCHANGES [--uri=URI] [--api=APIURI] [--saveto=DIR] [--format=FORMAT|--json]
+              [--limit=NUM] [--idle-timeout=DURATION] [--filter=EXPR] [--silent]
+              [TAPOPTIONS] [TLSOPTIONS] [COMMON OPTIONS]
+  rabtap (tap --uri=URI EXCHANGES)... [--api=APIURI] [--saveto=DIR] [--format=FORMAT|--json]
+              [--limit=NUM] [--idle-timeout=DURATION] [--filter=EXPR] [--silent]
+              [TAPOPTIONS] [TLSOPTIONS] [COMMON OPTIONS]
+  rabtap tap --all-exchanges [--exchange-filter=EXPR] [--rescan=DURATION] [--uri=URI]
+              [--api=APIURI] [--saveto=DIR] [--format=FORMAT|--json] [--limit=NUM]
+              [--idle-timeout=DURATION] [--filter=EXPR] [--silent] [TAPOPTIONS]
+              [TLSOPTIONS] [COMMON OPTIONS]
+  rabtap tap --firehose [--events=EVENTS] [--uri=URI] [--api=APIURI] [--saveto=DIR]
+              [--format=FORMAT|--json] [--limit=NUM] [--idle-timeout=DURATION]
+              [--filter=EXPR] [--silent] [TAPOPTIONS] [TLSOPTIONS] [COMMON OPTIONS]
+  rabtap mirror EXCHANGES --to-uri=URI [--uri=URI] [--api=APIURI] [--filter=EXPR]
+              [(--rename-exchange=KV)...] [--sample=RATIO] [--rate=RATE] [--limit=NUM]
+              [--idle-timeout=DURATION] [TAPOPTIONS] [TLSOPTIONS] [COMMON OPTIONS]
   rabtap sub QUEUE [--uri URI] [--saveto=DIR] [--format=FORMAT|--json] [--limit=NUM]
               [--offset=OFFSET] [--args=KV]... [(--reject [--requeue])] [--silent]
-              [--filter=EXPR] [--idle-timeout=DURATION] [TLSOPTIONS] [COMMON OPTIONS]
-  rabtap pub  [--uri=URI] [SOURCE] [--exchange=EXCHANGE] [--format=FORMAT|--json]
-              [--routingkey=KEY | (--header=KV)...] [ (--property=KV)... ] [--confirms]
-              [--mandatory] [--delay=DURATION | --speed=FACTOR] [TLSOPTIONS] [COMMON OPTIONS]
+              [--filter=EXPR | --ack-if=EXPR] [--idle-timeout=DURATION] [--prefetch=NUM]
+              [--ack-mode=MODE] [--ack-batch=NUM [--ack-interval=DURATION]]
+              [TLSOPTIONS] [COMMON OPTIONS]
+  rabtap pub  [--uri=URI] [SOURCE | --generate=TEMPLATE [--count=NUM] [--data=FILE]]
+              [--exchange=EXCHANGE] [--format=FORMAT|--json] [(--map=KV)...]
+              [--routingkey=KEY | (--header=KV)...] [ (--property=KV)... ]
+              [--filter=EXPR] [(--transform=EXPR)...]
+              [--confirms [--confirm-window=NUM] | --tx [--batch-size=NUM]]
+              [--reject-file=FILE] [--mandatory] [--blocked-timeout=DURATION]
+              [--delay=DURATION | --speed=FACTOR | --rate=RATE] [--repeat=NUM | --loop]
+              [TLSOPTIONS] [COMMON OPTIONS]
+  rabtap rpc [--uri=URI] [SOURCE] [--exchange=EXCHANGE] [--routingkey=KEY]
+              [(--header=KV)...] [(--property=KV)...] [--format=FORMAT|--json]
+              [--timeout=DURATION] [--temp-reply-queue] [--saveto=DIR] [--silent]
+              [TLSOPTIONS] [COMMON OPTIONS]
+  rabtap respond QUEUE --replies=DIR [--uri=URI] [--format=FORMAT|--json]
+              [--delay=DURATION] [--limit=NUM] [--idle-timeout=DURATION]
+              [TLSOPTIONS] [COMMON OPTIONS]
+  rabtap move SRC_QUEUE (--to-exchange=EXCHANGE | --to-origin) [--uri=URI] [--to-uri=URI]
+              [--filter=EXPR] [--limit=NUM] [--idle-timeout=DURATION] [--prefetch=NUM]
+              [--routingkey=KEY] [(--header=KV)...] [(--property=KV)...] [TLSOPTIONS]
+              [COMMON OPTIONS]
   rabtap exchange create EXCHANGE [--uri=URI] [--type=TYPE] [--args=KV]...
               [--autodelete] [--transient] [TLSOPTIONS] [COMMON OPTIONS]
   rabtap exchange bind EXCHANGE to DESTEXCHANGE [--uri=URI]
@@ -64,6 +98,8 @@ Usage:
               (--bindingkey=KEY | (--header=KV)... (--all|--any)) [TLSOPTIONS] [COMMON OPTIONS]
   rabtap queue rm QUEUE [--uri=URI] [TLSOPTIONS] [COMMON OPTIONS]
   rabtap queue purge QUEUE [--uri=URI] [TLSOPTIONS] [COMMON OPTIONS]
+  rabtap queue peek QUEUE [--uri=URI] [--count=NUM] [--saveto=DIR] [--format=FORMAT]
+              [--silent] [TLSOPTIONS] [COMMON OPTIONS]
   rabtap conn close CONNECTION [--api=APIURI] [--reason=REASON] [TLSOPTIONS] [COMMON OPTIONS]
   rabtap --version
   rabtap (-h | --help | help) [properties]
@@ -71,35 +107,78 @@ Usage:
 	options = `
 Arguments and options:
  EXCHANGES            comma-separated list of exchanges and optional binding keys,
-                      e.g. 'amq.topic:#' or 'exchange1:key1,exchange2:key2'
+                      e.g. 'amq.topic:#' or 'exchange1:key1,exchange2:key2'. Header
+                      matches start with x-match, e.g. 'amq.headers:x-match=all,tenant=acme'.
+                      Bindings of exchanges without key are discovered using the API.
+                      An exchange named 'cleanup' must be escaped, e.g. '\cleanup',
+                      since 'tap cleanup' removes orphaned tap exchanges and queues.
  EXCHANGE             name of an exchange, e.g. 'amq.direct'
  DESTEXCHANGE         name of a a destination exchange in an exchange-to-exchange binding
- SOURCE               file or directory to publish in pub mode. If omitted, stdin will be read
+ SOURCE               file or directory to publish in pub mode, or file with the request in
+                      rpc mode. If omitted, stdin will be read
  QUEUE                name of a queue
+ SRC_QUEUE            name of the queue to move messages from
  CONNECTION           name of a connection
  DIR                  directory to read messages from
  DURATION             a numerical duration with a unit suffix like "ms", "s", "m", "h"
  -a, --autodelete     create auto delete exchange/queue
+ --ack-if=EXPR        drain a queue in sub command: acknowledge (and print/save) only messages
+                      matching the predicate EXPR, requeue all others and stop when all
+                      messages in the queue were received once. Stops also when no message
+                      was received for --idle-timeout, which defaults to 10s
+ --ack-batch=NUM      acknowledge messages in batches of NUM messages in sub command
+ --ack-interval=DURATION
+                      acknowledge a batch of messages latest after DURATION [default: 1s]
+ --ack-mode=MODE      when messages are acknowledged in sub command. One of 'receive' (on
+                      receipt), 'processed' (after written), 'filtered' (after written,
+                      only messages passing the filter) or 'never'. Can not be used with
+                      --ack-if. Default: 'receive'
  --all                set x-match=all option in header based routing
+ --all-exchanges      tap all exchanges of the vhost of the broker (see --exchange-filter)
  --any                set x-match=any option in header based routing
  --api=APIURI         connect to given API server. If APIURL is omitted, the environment
                       variable RABTAP_APIURI will be used
  --args=KV            A key value pair in the form of "key=value" passed as additional
                       arguments. e.g. '--args=x-queue-type=quorum'
+ --batch-size=NUM     number of messages committed in a transaction with --tx
+                      [default: 100]
  -b, --bindingkey=KEY binding key to use in bind queue command
+ --blocked-timeout=DURATION  fail publishing when the broker blocks publishing, e.g.
+                      due to a memory or disk alarm, for longer than DURATION.
+                      If not set, wait until publishing is resumed.
  --by-connection      output of info command starts with connections
  --confirms           enable publisher confirms and wait for confirmations
+ --confirm-window=NUM max. number of published messages waiting for a confirmation
+                      [default: 100]
  --consumers          include consumers and connections in output of info command
+ --count=NUM          number of messages to show with queue peek, or to generate with
+                      pub --generate [default: 1]
+ --data=FILE          JSON file with values passed as .Data to the template of pub --generate
+ --dry-run            only show what would be done, without changing anything
  --delay=DURATION     Time to wait between sending messages during publish. If not set,
-                      then messages will be delayed as recorded.
+                      then messages will be delayed as recorded. In respond command, time
+                      to wait before sending a reply
+ --events=EVENTS      comma separated list of events to tap with --firehose. An event is
+                      one of 'publish', 'deliver', 'publish.EXCHANGE' or 'deliver.QUEUE'
+                      [default: publish,deliver]
  --exchange=EXCHANGE  optional exchange to publish to. If omitted, exchange will be taken
                       from message being published (see JSON message format)
- --filter=EXPR        Predicate for sub, tap, info command to filter the output [default: true]
- --format=FORMAT      for tap, pub, sub command: format to write/read messages to console
+ --exchange-filter=EXPR
+                      Predicate selecting the exchanges to tap with the --all-exchanges
+                      option, e.g. "r.exchange.Name matches '^orders'" [default: true]
+ --filter=EXPR        Predicate for sub, tap, info, pub command to filter the output or the
+                      messages to publish [default: true]
+ --format=FORMAT      for tap, pub, sub, rpc command: format to write/read messages to console
                         and optionally to file (when --saveto DIR is given).
                         Valid options are: 'raw', 'json', 'json-nopp'. Default: 'raw'
+                        pub also reads 'csv', 'lines' and 'jsonl-body' (one JSON body
+                        per line), with one message per row or line
                       for info command: controls generated output format. Valid options
                         are: 'text', 'dot'. Default: 'text'
+ --firehose           tap all messages published or delivered on the vhost of the broker
+                      using the RabbitMQ firehose tracer, which is enabled using the API
+ --generate=TEMPLATE  publish messages rendered from the Go text/template in file TEMPLATE
+                      instead of reading them from SOURCE. See "Generate messages" in README
  -h, --help           prints this help
  --header=KV          A key value pair in the form of "key=value" used as a routing- or
                       binding-key. Can occur multiple times
@@ -109,29 +188,67 @@ Arguments and options:
  --lazy               create a lazy queue
  --limit=NUM          Stop afer NUM messages were received. When set to 0, will run until
                       terminated [default: 0]
+ --loop               publish the messages of the source endlessly in pub command
  --mandatory          enable mandatory publishing (messages must be delivered to queue)
+ --map=KV             set a message field from a column of format csv or a JSON path of
+                      format jsonl-body in pub command, e.g. 'RoutingKey=region' or
+                      'Header.tenant=customer.tenant'. Fields are Body, Exchange,
+                      RoutingKey, Header.NAME or a property. Can occur multiple times
+ --min-idle=DURATION  min. time a tap queue must be idle to be removed by tap cleanup
+                      [default: 5m]
  --mode=MODE          mode for info command. One of 'byConnection', 'byExchange' [default: byExchange]
  --omit-empty         don't show echanges without bindings in info command
  --offset=OFFSET      Offset when reading from a stream. Can be 'first', 'last', 'next',
                       a DURATION like '10m', a RFC3339-Timestamp or an integer index value.
                       Basically it is an alias for '--args=x-stream-offset=OFFSET'
+ --prefetch=NUM       number of unacknowledged messages delivered by the broker in sub
+                      and move command. Defaults to 1, or NUM of --ack-batch, or is
+                      unlimited with the 'filtered' and 'never' ack modes. Defaults
+                      to 1000 in move command with --filter
  --property=KV        A key value pair in the form of "key=value" to specify message properties
                       like e.g. the content-type.
  --queue-type=TYPE    type of queue [default: classic]
+ --rate=RATE          max. number of messages per second in mirror and pub command, either a
+                      number or a number per unit 's', 'm' or 'h', e.g. '100/s' or '10/m'.
+                      The mirror command drops messages exceeding the rate, the pub command
+                      delays them
  --reason=REASON      reason why the connection was closed [default: closed by rabtap]
  --reject             Reject messages. Default behaviour is to acknowledge messages
+ --reject-file=FILE   write messages that could not be published in pub command to FILE
+                      in JSON format, e.g. messages of a rolled back transaction
+ --replies=DIR        directory with the recorded replies of the respond command
+ --rename-exchange=KV rename exchanges in mirror command, e.g. 'orders=orders-staging'
+ --repeat=NUM         publish the messages of the source NUM times in pub command [default: 1]
+ --rescan=DURATION    periodically look for new exchanges to tap with --all-exchanges
  --requeue            Instruct broker to requeue rejected message
  -r, --routingkey=KEY routing key to use in publish mode. If omitted, routing key
                       will be taken from message being published (see JSON message format)
+ --sample=RATIO       ratio of messages to mirror in mirror command, between 0 and 1 [default: 1]
  --saveto=DIR         also save messages and metadata to DIR
  --show-default       include default exchange in output info command
  -s, --silent         suppress message output to stdout
  --speed=FACTOR       Speed factor to use during publish [default: 1.0]
  --stats              include statistics in output of info command
+ --temp-reply-queue   receive the reply of the rpc command on a temporary, exclusive queue
+                      instead of using direct reply-to
+ --timeout=DURATION   time to wait for the reply in rpc command [default: 5s]
+ --to-origin          move dead-lettered messages to the exchange and with the routing key
+                      they were originally published with, as recorded in the x-death header
+ --to-exchange=EXCHANGE
+                      exchange to move messages to
+ --to-uri=URI         broker to move or mirror messages to. For move, defaults to the broker
+                      given by --uri
  -t, --type=TYPE      type of exchange [default: fanout]
+ --transform=EXPR     set a message field to the result of an expression in pub command, in
+                      the form FIELD=EXPR, e.g. 'RoutingKey="test." + r.msg.RoutingKey'.
+                      Fields are Body, Body.PATH of a JSON body, Exchange, RoutingKey,
+                      Header.NAME or a property. Can occur multiple times
  --transient          create a transient exchange/queue (default is durable)
+ --tx                 publish messages in transactions, each committing --batch-size
+                      messages. A transaction failing to commit is rolled back
  --uri=URI            connect to given AQMP broker. If omitted, the environment variable
                       RABTAP_AMQPURI will be used
+ --vhost=VHOST        restrict command to the given vhost
  --version            show version information and exit
 
 Common options:
@@ -139,6 +256,27 @@ Common options:
  -n, --no-color       don't colorize output (see also environment variable NO_COLOR)
  -v, --verbose        enable verbose mode
 
+Tap options:
+ --tap-prefix=PREFIX  prefix of the exchanges and queues created by tap [default: __tap-]
+ --tap-name-template=TEMPLATE
+                      template of the names of the exchanges and queues created by tap,
+                      with the fields .Prefix, .Kind ('exchange' or 'queue'), .Exchange
+                      and .ID, of which .Exchange and .ID are required.
+                      Default: '{{.Prefix}}{{.Kind}}-for-{{.Exchange}}-{{.ID}}'
+ --tap-queue=QUEUE    tap through the existing QUEUE instead of creating exchanges and
+                      queues. The tapped exchanges are bound to QUEUE during the tap.
+ --tap-max-length=NUM limit the number of messages in a tap queue. When reached, the
+                      oldest messages are dropped
+ --tap-max-length-bytes=NUM
+                      limit the total size of message bodies in a tap queue in bytes.
+                      When reached, the oldest messages are dropped
+ --tap-message-ttl=DURATION
+                      drop messages not consumed from a tap queue within DURATION
+                      Messages dropped from a bounded tap queue are reported when the
+                      tap ends, which requires the management API (see --api)
+ --dedup=DURATION     suppress duplicates of messages received within DURATION, e.g.
+                      through overlapping taps. Messages are shown after DURATION.
+
 TLS options:
  --tls-cert-file=CERTFILE A Cert file to use for client authentication
  --tls-key-file=KEYFILE   A Key file to use for client authentication
@@ -192,6 +330,9 @@ UserId          - user id, validated if set
 `
 	tlsOptions    = "[(--tls-cert-file=CERTFILE --tls-key-file=KEYFILE)] [--tls-ca-file=CAFILE] [--insecure]"
 	commonOptions = "[--verbose] [--no-color|--color]"
+	tapOptions    = "[--tap-prefix=PREFIX] [--tap-name-template=TEMPLATE] [--tap-queue=QUEUE] " +
+		"[--tap-max-length=NUM] [--tap-max-length-bytes=NUM] [--tap-message-ttl=DURATION] " +
+		"[--dedup=DURATION]"
 )
 
 // ProgramCmd represents the mode of operation
@@ -223,8 +364,20 @@ const (
 	QueueUnbindCmd
 	// QueuePurgeCmd purges a queue
 	QueuePurgeCmd
+	// QueuePeekCmd shows messages of a queue without consuming them
+	QueuePeekCmd
 	// ConnCloseCmd closes a connection
 	ConnCloseCmd
+	// TapCleanupCmd removes orphaned tap exchanges and queues
+	TapCleanupCmd
+	// MoveCmd moves messages from a queue to an exchange
+	MoveCmd
+	// MirrorCmd mirrors tapped messages to another broker
+	MirrorCmd
+	// RPCCmd sends a request and waits for the reply
+	RPCCmd
+	// RespondCmd answers requests with recorded replies
+	RespondCmd
 	// VersionCmd prints version information
 	VersionCmd
 )
@@ -285,6 +438,21 @@ type commonArgs struct {
 
 const InfiniteMessages = int64(0)
 
+// DrainIdleTimeout is the default idle timeout when draining a queue with
+// --ack-if or the move command. The number of messages in the queue may never
+// be reached, e.g. when a competing consumer receives some of the messages.
+const DrainIdleTimeout = 10 * time.Second
+
+// MoveFilterPrefetch is the default prefetch count of the move command with
+// --filter. Messages not passing the filter are kept unacknowledged until the
+// move ends, so the prefetch count limits the skipped messages held in memory.
+const MoveFilterPrefetch = 1000
+
+// TapCleanupSettleTime is the time after which tap cleanup checks orphaned tap
+// exchanges again before deleting them. Exchanges have no idle time, and the
+// exchange of a tap being set up is not yet bound to its queue.
+const TapCleanupSettleTime = 10 * time.Second
+
 // CommandLineArgs represents the parsed command line arguments
 // TODO does not scale well - split in per-cmd structs
 type CommandLineArgs struct {
@@ -294,19 +462,40 @@ type CommandLineArgs struct {
 	TapConfig []rabtap.TapConfiguration // configuration in tap mode
 	APIURL    *url.URL
 
-	PubExchange         *string        // pub: exchange to publish to
-	PubRoutingKey       *string        // pub: routing key, defaults to ""
-	Source              *string        // pub: file to send
+	PubExchange         *string        // pub, move, rpc: exchange to publish to
+	PubRoutingKey       *string        // pub, move, rpc: routing key, defaults to ""
+	ToAMQPURL           *url.URL       // move, mirror: broker to publish to
+	ToOrigin            bool           // move: publish to original exchange of dead-lettered messages
+	Source              *string        // pub, rpc: file to send
+	GenerateTemplate    *string        // pub: template to generate messages from
+	FieldMapping        FieldMapping   // pub: message fields read from csv columns or JSON paths
+	Transforms          []string       // pub: transformations of the form FIELD=EXPR
+	TemplateData        *string        // pub: file with values passed to the template
+	ReplyTimeout        time.Duration  // rpc: time to wait for the reply
+	TempReplyQueue      bool           // rpc: receive reply on temporary queue
+	RepliesDir          string         // respond: directory with recorded replies
 	Speed               float64        // pub: speed factor
-	Delay               *time.Duration // pub: fixed delay in ms
+	Delay               *time.Duration // pub, respond: fixed delay in ms
 	Confirms            bool           // pub: wait for confirmations
+	ConfirmWindow       int            // pub: max. number of unconfirmed messages
+	BlockedTimeout      time.Duration  // pub: max. time publishing may be blocked, 0=forever
+	TxBatchSize         int            // pub: messages per transaction, 0=no transactions
+	RejectFile          string         // pub: file to write messages to that were not published
+	Repeat              int            // pub: number of times to publish the source, 0=forever
 	Mandatory           bool           // pub: set mandatory flag
 	Properties          PropertiesOverride
+	TapSetup            rabtap.AmqpTapConfig
 	Limit               int64             // sub: optional limit
+	Count               int               // queue peek, pub: number of messages
 	Reject              bool              // sub: reject messages
 	Requeue             bool              // sub: requeue rejectied messages
+	Prefetch            int               // sub, move: number of unacknowledged messages
+	AckBatch            int               // sub: acknowledge messages in batches
+	AckInterval         time.Duration     // sub: max duration of a batch
+	AckMode             AckMode           // sub: when messages are acknowledged
+	Drain               bool              // sub: stop when all messages were received once
 	IdleTimeout         time.Duration     // sub: idle timeout
-	QueueName           string            // queue create, remove, bind, sub
+	QueueName           string            // queue create, remove, bind, sub, move
 	BindingKey          string            // a binding key
 	ExchangeName        string            // exchange name  create, remove or queue bind
 	DestExchangeName    string            // target exchange name  bind e2e
@@ -316,7 +505,15 @@ type CommandLineArgs struct {
 	ShowStats           bool              // info: also show statistics
 	OmitEmptyExchanges  bool              // info: do not show exchanges wo/ bindings
 	ShowDefaultExchange bool              // info: show default exchange
-	Filter              string            // sub/tap/info: optional filter predicate
+	Filter              string            // sub/tap/info/pub: optional filter predicate
+	AllExchanges        bool              // tap: tap all exchanges of the vhost
+	ExchangeFilter      string            // tap: filter predicate for --all-exchanges
+	RescanInterval      time.Duration     // tap: rescan interval for --all-exchanges
+	Firehose            bool              // tap: tap the firehose tracer
+	DedupWindow         time.Duration     // tap: optional window to suppress duplicates in
+	ExchangeRenames     map[string]string // mirror: maps source to destination exchanges
+	SampleRatio         float64           // mirror: ratio of messages to mirror
+	Rate                float64           // mirror, pub: max messages per second
 	Format              string            // output format, depends on command
 	Transient           bool              // queue create, exchange create
 	Autodelete          bool              // queue create, exchange create
@@ -326,6 +523,9 @@ type CommandLineArgs struct {
 	ConnName            string            // conn: name of connection
 	CloseReason         string            // conn: reason of close
 	HeaderMode          HeaderMode        // queue ceate, header based routing
+	Vhost               string            // tap cleanup: optional vhost
+	DryRun              bool              // tap cleanup: do not delete anything
+	MinIdle             time.Duration     // tap cleanup: min. idle time of a tap queue
 	HelpTopic           HelpTopic
 }
 
@@ -443,6 +643,15 @@ func parseConnCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
 	return result, nil
 }
 
+// parsePubFormatArg parses the --format=FORMAT option of the pub command,
+// which additionally supports the formats read by NewRecordMessageSource
+func parsePubFormatArg(args map[string]interface{}) (string, error) {
+	if format, ok := args["--format"].(string); ok && IsRecordFormat(format) {
+		return format, nil
+	}
+	return parsePubSubFormatArg(args)
+}
+
 // parsePubSubFormatArg parse --format=FORMAT option for pub, sub, tap command.
 func parsePubSubFormatArg(args map[string]interface{}) (string, error) {
 	format := "raw"
@@ -510,9 +719,89 @@ func parseSubCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
 	if offset := args["--offset"]; offset != nil {
 		result.Args["x-stream-offset"] = offset.(string)
 	}
+	if err := parseSubAckArgs(args, &result); err != nil {
+		return result, err
+	}
+	if ackIf := args["--ack-if"]; ackIf != nil {
+		if result.AckBatch > 1 {
+			return result, fmt.Errorf("--ack-batch can not be used with --ack-if")
+		}
+		if args["--ack-mode"] != nil {
+			return result, fmt.Errorf("--ack-mode can not be used with --ack-if")
+		}
+		if args["--idle-timeout"] == nil {
+			result.IdleTimeout = DrainIdleTimeout
+		}
+		// only acknowledge messages passing the predicate, keep all others
+		result.Filter = ackIf.(string)
+		result.AckMode = AckOnFiltered
+		result.Drain = true
+		if args["--prefetch"] == nil {
+			result.Prefetch = rabtap.PrefetchUnlimited
+		}
+	}
 	return result, nil
 }
 
+func parseAckMode(mode string) (AckMode, error) {
+	switch mode {
+	case "receive":
+		return AckOnReceive, nil
+	case "processed":
+		return AckOnProcessed, nil
+	case "filtered":
+		return AckOnFiltered, nil
+	case "never":
+		return AckNever, nil
+	default:
+		return AckOnReceive, fmt.Errorf("invalid --ack-mode: %s", mode)
+	}
+}
+
+// parseSubAckArgs parses the prefetch and batched acknowledgement options of
+// the sub command. The prefetch count defaults to the batch size, since
+// otherwise a batch could never be completed, and is unlimited when messages
+// are kept unacknowledged.
+func parseSubAckArgs(args map[string]interface{}, result *CommandLineArgs) error {
+	result.AckBatch = 1
+	if args["--ack-batch"] != nil {
+		batch, err := strconv.Atoi(args["--ack-batch"].(string))
+		if err != nil || batch < 1 {
+			return fmt.Errorf("failed to parse --ack-batch: invalid value %q", args["--ack-batch"])
+		}
+		result.AckBatch = batch
+	}
+	var err error
+	if result.AckInterval, err = time.ParseDuration(args["--ack-interval"].(string)); err != nil {
+		return fmt.Errorf("failed to parse --ack-interval: %w", err)
+	}
+	mode := "receive"
+	if args["--ack-mode"] != nil {
+		mode = args["--ack-mode"].(string)
+	}
+	if result.AckMode, err = parseAckMode(mode); err != nil {
+		return err
+	}
+	result.Prefetch = result.AckBatch
+	if result.AckMode.KeepsMessagesUnacknowledged() {
+		if result.AckBatch > 1 {
+			return fmt.Errorf("--ack-batch can not be used with --ack-mode=%s", mode)
+		}
+		result.Prefetch = rabtap.PrefetchUnlimited
+	}
+	if args["--prefetch"] != nil {
+		prefetch, err := strconv.Atoi(args["--prefetch"].(string))
+		if err != nil || prefetch < 1 {
+			return fmt.Errorf("failed to parse --prefetch: invalid value %q", args["--prefetch"])
+		}
+		if prefetch < result.AckBatch {
+			return fmt.Errorf("--prefetch must not be smaller than --ack-batch")
+		}
+		result.Prefetch = prefetch
+	}
+	return nil
+}
+
 func parseBindingKey(args map[string]interface{}) string {
 	if key, ok := args["--bindingkey"].(string); ok {
 		return key
@@ -587,6 +876,21 @@ func parseQueueCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
 		result.ExchangeName = args["EXCHANGE"].(string)
 	case args["purge"].(bool):
 		result.Cmd = QueuePurgeCmd
+	case args["peek"].(bool):
+		result.Cmd = QueuePeekCmd
+		result.Silent = args["--silent"].(bool)
+		count, err := strconv.Atoi(args["--count"].(string))
+		if err != nil || count < 1 {
+			return result, fmt.Errorf("failed to parse --count: invalid value %q", args["--count"])
+		}
+		result.Count = count
+		if result.Format, err = parsePubSubFormatArg(args); err != nil {
+			return result, err
+		}
+		if args["--saveto"] != nil {
+			saveDir := args["--saveto"].(string)
+			result.SaveDir = &saveDir
+		}
 	}
 	return result, nil
 }
@@ -634,10 +938,12 @@ func parsePublishCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
 		Cmd:        PubCmd,
 		Confirms:   args["--confirms"].(bool),
 		Mandatory:  args["--mandatory"].(bool),
+		Filter:     args["--filter"].(string),
+		Transforms: args["--transform"].([]string),
 		commonArgs: parseCommonArgs(args),
 	}
 
-	format, err := parsePubSubFormatArg(args)
+	format, err := parsePubFormatArg(args)
 	if err != nil {
 		return result, err
 	}
@@ -646,6 +952,41 @@ func parsePublishCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
 	if result.AMQPURL, err = parseAMQPURL(args); err != nil {
 		return result, err
 	}
+	if result.FieldMapping, err = parseKVListOption("--map", args); err != nil {
+		return result, fmt.Errorf("failed to parse --map: %w", err)
+	}
+	if len(result.FieldMapping) > 0 && format != "csv" && format != "jsonl-body" {
+		return result, errors.New("--map requires --format=csv or --format=jsonl-body")
+	}
+	if result.ConfirmWindow, err = strconv.Atoi(args["--confirm-window"].(string)); err != nil {
+		return result, fmt.Errorf("failed to parse --confirm-window: %w", err)
+	}
+	if args["--tx"].(bool) {
+		if result.TxBatchSize, err = strconv.Atoi(args["--batch-size"].(string)); err != nil {
+			return result, fmt.Errorf("failed to parse --batch-size: %w", err)
+		}
+		if result.TxBatchSize < 1 {
+			return result, fmt.Errorf("--batch-size must be at least 1")
+		}
+	}
+	if args["--loop"].(bool) {
+		result.Repeat = 0
+	} else if result.Repeat, err = strconv.Atoi(args["--repeat"].(string)); err != nil || result.Repeat < 1 {
+		return result, fmt.Errorf("failed to parse --repeat: invalid value %q", args["--repeat"])
+	}
+	if rate := args["--rate"]; rate != nil {
+		if result.Rate, err = parseRate(rate.(string)); err != nil {
+			return result, fmt.Errorf("failed to parse --rate: %w", err)
+		}
+	}
+	if args["--reject-file"] != nil {
+		result.RejectFile = args["--reject-file"].(string)
+	}
+	if timeout := args["--blocked-timeout"]; timeout != nil {
+		if result.BlockedTimeout, err = time.ParseDuration(timeout.(string)); err != nil {
+			return result, fmt.Errorf("failed to parse --blocked-timeout: %w", err)
+		}
+	}
 	if args["--exchange"] != nil {
 		exchange := args["--exchange"].(string)
 		result.PubExchange = &exchange
@@ -662,6 +1003,19 @@ func parsePublishCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
 		file := args["SOURCE"].(string)
 		result.Source = &file
 	}
+	if args["--generate"] != nil {
+		tpl := args["--generate"].(string)
+		result.GenerateTemplate = &tpl
+		count, err := strconv.Atoi(args["--count"].(string))
+		if err != nil || count < 1 {
+			return result, fmt.Errorf("failed to parse --count: invalid value %q", args["--count"])
+		}
+		result.Count = count
+		if args["--data"] != nil {
+			data := args["--data"].(string)
+			result.TemplateData = &data
+		}
+	}
 	if args["--delay"] != nil {
 		delay, err := time.ParseDuration(args["--delay"].(string))
 		if err != nil {
@@ -675,20 +1029,154 @@ func parsePublishCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
 			return result, fmt.Errorf("failed to parse --speed: %w", err)
 		}
 	}
-	// multiple --property K=V allow to override message properties
+	result.Properties, err = parsePropertyOverrideArgs(args)
+	return result, err
+}
+
+// parsePropertyOverrideArgs parses multiple --property K=V options, which
+// allow to override message properties
+func parsePropertyOverrideArgs(args map[string]interface{}) (PropertiesOverride, error) {
 	propsKV, err := parseKVListOption("--property", args)
 	if err != nil {
-		return result, fmt.Errorf("parse properties: %w", err)
+		return PropertiesOverride{}, fmt.Errorf("parse properties: %w", err)
 	}
 	props, err := parseMessageProperties(propsKV)
 	if err != nil {
-		return result, fmt.Errorf("parse properties: %w", err)
+		return PropertiesOverride{}, fmt.Errorf("parse properties: %w", err)
 	}
-	result.Properties = props
+	return props, nil
+}
 
+func parseRPCCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
+	result := CommandLineArgs{
+		Cmd:            RPCCmd,
+		commonArgs:     parseCommonArgs(args),
+		TempReplyQueue: args["--temp-reply-queue"].(bool),
+		Silent:         args["--silent"].(bool),
+	}
+
+	var err error
+	if result.Format, err = parsePubSubFormatArg(args); err != nil {
+		return result, err
+	}
+	if result.AMQPURL, err = parseAMQPURL(args); err != nil {
+		return result, err
+	}
+	if args["--exchange"] != nil {
+		exchange := args["--exchange"].(string)
+		result.PubExchange = &exchange
+	}
+	if args["--routingkey"] != nil {
+		routingKey := args["--routingkey"].(string)
+		result.PubRoutingKey = &routingKey
+	}
+	if args["SOURCE"] != nil {
+		file := args["SOURCE"].(string)
+		result.Source = &file
+	}
+	if args["--saveto"] != nil {
+		saveDir := args["--saveto"].(string)
+		result.SaveDir = &saveDir
+	}
+	if result.Args, err = parseKVListOption("--header", args); err != nil {
+		return result, fmt.Errorf("failed to parse --header: %w", err)
+	}
+	if result.ReplyTimeout, err = time.ParseDuration(args["--timeout"].(string)); err != nil {
+		return result, fmt.Errorf("failed to parse --timeout: %w", err)
+	}
+	result.Properties, err = parsePropertyOverrideArgs(args)
+	return result, err
+}
+
+func parseRespondCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
+	result := CommandLineArgs{
+		Cmd:         RespondCmd,
+		commonArgs:  parseCommonArgs(args),
+		QueueName:   args["QUEUE"].(string),
+		RepliesDir:  args["--replies"].(string),
+		IdleTimeout: time.Duration(math.MaxInt64),
+	}
+
+	var err error
+	if result.Format, err = parsePubSubFormatArg(args); err != nil {
+		return result, err
+	}
+	if result.AMQPURL, err = parseAMQPURL(args); err != nil {
+		return result, err
+	}
+	if result.Limit, err = strconv.ParseInt(args["--limit"].(string), 10, 64); err != nil {
+		return result, fmt.Errorf("failed to parse --limit: %w", err)
+	}
+	if args["--idle-timeout"] != nil {
+		if result.IdleTimeout, err = time.ParseDuration(args["--idle-timeout"].(string)); err != nil {
+			return result, fmt.Errorf("failed to parse --idle-timeout: %w", err)
+		}
+	}
+	if args["--delay"] != nil {
+		delay, err := time.ParseDuration(args["--delay"].(string))
+		if err != nil {
+			return result, fmt.Errorf("failed to parse --delay: %w", err)
+		}
+		result.Delay = &delay
+	}
 	return result, nil
 }
 
+func parseMoveCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
+	result := CommandLineArgs{
+		Cmd:         MoveCmd,
+		commonArgs:  parseCommonArgs(args),
+		QueueName:   args["SRC_QUEUE"].(string),
+		ToOrigin:    args["--to-origin"].(bool),
+		Filter:      args["--filter"].(string),
+		IdleTimeout: DrainIdleTimeout,
+		AckMode:     AckOnProcessed,
+	}
+	if exchange, ok := args["--to-exchange"].(string); ok {
+		result.PubExchange = &exchange
+	}
+
+	var err error
+	if result.AMQPURL, err = parseAMQPURL(args); err != nil {
+		return result, fmt.Errorf("failed to parse AMQP URL: %w", err)
+	}
+	result.ToAMQPURL = result.AMQPURL
+	if toURI := args["--to-uri"]; toURI != nil {
+		if result.ToAMQPURL, err = url.Parse(toURI.(string)); err != nil {
+			return result, fmt.Errorf("failed to parse --to-uri: %w", err)
+		}
+	}
+	if result.Limit, err = strconv.ParseInt(args["--limit"].(string), 10, 64); err != nil {
+		return result, fmt.Errorf("failed to parse --limit: %w", err)
+	}
+	if args["--idle-timeout"] != nil {
+		if result.IdleTimeout, err = time.ParseDuration(args["--idle-timeout"].(string)); err != nil {
+			return result, fmt.Errorf("failed to parse --idle-timeout: %w", err)
+		}
+	}
+	if args["--routingkey"] != nil {
+		routingKey := args["--routingkey"].(string)
+		result.PubRoutingKey = &routingKey
+	}
+	if result.Args, err = parseKVListOption("--header", args); err != nil {
+		return result, fmt.Errorf("failed to parse --header: %w", err)
+	}
+	if result.Filter != "true" {
+		// messages not passing the filter are kept in the source queue
+		result.AckMode = AckOnFiltered
+		result.Prefetch = MoveFilterPrefetch
+	}
+	if args["--prefetch"] != nil {
+		prefetch, err := strconv.Atoi(args["--prefetch"].(string))
+		if err != nil || prefetch < 1 {
+			return result, fmt.Errorf("failed to parse --prefetch: invalid value %q", args["--prefetch"])
+		}
+		result.Prefetch = prefetch
+	}
+	result.Properties, err = parsePropertyOverrideArgs(args)
+	return result, err
+}
+
 func parseTapCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
 	result := CommandLineArgs{
 		Cmd:         TapCmd,
@@ -724,7 +1212,27 @@ func parseTapCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
 		saveDir := args["--saveto"].(string)
 		result.SaveDir = &saveDir
 	}
+	if dedup := args["--dedup"]; dedup != nil {
+		if result.DedupWindow, err = time.ParseDuration(dedup.(string)); err != nil {
+			return result, fmt.Errorf("failed to parse --dedup: %w", err)
+		}
+	}
+	// the management API is optional and only needed to discover bindings
+	if args["--api"] != nil || os.Getenv("RABTAP_APIURI") != "" {
+		if result.APIURL, err = parseAPIURI(args); err != nil {
+			return result, fmt.Errorf("failed to parse API URL: %w", err)
+		}
+	}
+	if result.TapSetup, err = parseTapSetupArgs(args); err != nil {
+		return result, err
+	}
 	amqpURLs := args["--uri"].([]string)
+	if allExchanges, ok := args["--all-exchanges"].(bool); ok && allExchanges {
+		return parseTapAllExchangesArgs(args, amqpURLs, result)
+	}
+	if firehose, ok := args["--firehose"].(bool); ok && firehose {
+		return parseTapFirehoseArgs(args, amqpURLs, result)
+	}
 	exchanges := args["EXCHANGES"].([]string)
 	for i, exchange := range exchanges {
 		// eihter the amqp uri is provided with --uri URI or the value
@@ -742,6 +1250,219 @@ func parseTapCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
 	return result, nil
 }
 
+// parseRate parses a rate given either as number of events per second, or
+// as a number of events per unit, e.g. "100/s", "10/m" or "1/h", and returns
+// the number of events per second.
+func parseRate(rate string) (float64, error) {
+	num, unit, found := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n <= 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid rate %q", rate)
+	}
+	if !found {
+		return n, nil
+	}
+	units := map[string]float64{"s": 1, "m": 60, "h": 3600}
+	seconds, ok := units[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid unit of rate %q", rate)
+	}
+	return n / seconds, nil
+}
+
+func parseMirrorCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
+	// the source of the mirror command is a tap
+	result, err := parseTapCmdArgs(args)
+	if err != nil {
+		return result, err
+	}
+	result.Cmd = MirrorCmd
+
+	if result.ToAMQPURL, err = url.Parse(args["--to-uri"].(string)); err != nil {
+		return result, fmt.Errorf("failed to parse --to-uri: %w", err)
+	}
+	if result.ExchangeRenames, err = parseKVListOption("--rename-exchange", args); err != nil {
+		return result, fmt.Errorf("failed to parse --rename-exchange: %w", err)
+	}
+	ratio, err := strconv.ParseFloat(args["--sample"].(string), 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return result, fmt.Errorf("failed to parse --sample: invalid value %q", args["--sample"])
+	}
+	result.SampleRatio = ratio
+	if rate := args["--rate"]; rate != nil {
+		if result.Rate, err = parseRate(rate.(string)); err != nil {
+			return result, fmt.Errorf("failed to parse --rate: %w", err)
+		}
+	}
+	return result, checkMirrorLoop(result)
+}
+
+// isSameBroker returns true if both URLs refer to the same vhost of the same
+// broker
+func isSameBroker(a, b *url.URL) bool {
+	uriA, errA := amqp.ParseURI(a.String())
+	uriB, errB := amqp.ParseURI(b.String())
+	if errA != nil || errB != nil {
+		return a.String() == b.String()
+	}
+	return strings.EqualFold(uriA.Host, uriB.Host) && uriA.Port == uriB.Port && uriA.Vhost == uriB.Vhost
+}
+
+// checkMirrorLoop returns an error if messages would be mirrored to an
+// exchange tapped by the mirror command itself, i.e. if a tapped exchange
+// is mirrored to a tapped exchange of the same broker and vhost. Every
+// mirrored message would then be tapped and mirrored again.
+func checkMirrorLoop(args CommandLineArgs) error {
+	for _, config := range args.TapConfig {
+		if !isSameBroker(config.AMQPURL, args.ToAMQPURL) {
+			continue
+		}
+		tapped := map[string]bool{}
+		for _, exchange := range config.Exchanges {
+			tapped[exchange.Exchange] = true
+		}
+		for _, exchange := range config.Exchanges {
+			dest := exchange.Exchange
+			if renamed, found := args.ExchangeRenames[dest]; found {
+				dest = renamed
+			}
+			if tapped[dest] {
+				return fmt.Errorf("mirroring exchange %s to the tapped exchange %s of the same broker "+
+					"would create a loop, use --rename-exchange", exchange.Exchange, dest)
+			}
+		}
+	}
+	return nil
+}
+
+func parseTapCleanupCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
+	result := CommandLineArgs{
+		Cmd:        TapCleanupCmd,
+		commonArgs: parseCommonArgs(args),
+		DryRun:     args["--dry-run"].(bool),
+		TapSetup:   rabtap.AmqpTapConfig{NamePrefix: args["--tap-prefix"].(string)},
+	}
+	// an empty prefix would match all exchanges and queues
+	if strings.TrimSpace(result.TapSetup.NamePrefix) == "" {
+		return result, errors.New("--tap-prefix must not be empty")
+	}
+	if args["--tap-name-template"] != nil {
+		result.TapSetup.NameTemplate = args["--tap-name-template"].(string)
+	}
+	if _, err := result.TapSetup.TapNamePattern("queue"); err != nil {
+		return result, fmt.Errorf("--tap-name-template: %w", err)
+	}
+	var err error
+	if result.APIURL, err = parseAPIURI(args); err != nil {
+		return result, fmt.Errorf("failed to parse API URL: %w", err)
+	}
+	if args["--vhost"] != nil {
+		result.Vhost = args["--vhost"].(string)
+	}
+	if result.MinIdle, err = time.ParseDuration(args["--min-idle"].(string)); err != nil {
+		return result, fmt.Errorf("failed to parse --min-idle: %w", err)
+	}
+	return result, nil
+}
+
+// parseTapSetupArgs parses the tap options controlling how the tap is set up
+func parseTapSetupArgs(args map[string]interface{}) (rabtap.AmqpTapConfig, error) {
+	config := rabtap.AmqpTapConfig{NamePrefix: args["--tap-prefix"].(string)}
+	if args["--tap-name-template"] != nil {
+		config.NameTemplate = args["--tap-name-template"].(string)
+	}
+	if args["--tap-queue"] != nil {
+		config.Queue = args["--tap-queue"].(string)
+	}
+	var err error
+	if args["--tap-max-length"] != nil {
+		if config.MaxLength, err = strconv.ParseInt(args["--tap-max-length"].(string), 10, 64); err != nil {
+			return config, fmt.Errorf("--tap-max-length: %w", err)
+		}
+		if config.MaxLength < 0 {
+			return config, errors.New("--tap-max-length must not be negative")
+		}
+	}
+	if args["--tap-max-length-bytes"] != nil {
+		if config.MaxLengthBytes, err = strconv.ParseInt(args["--tap-max-length-bytes"].(string), 10, 64); err != nil {
+			return config, fmt.Errorf("--tap-max-length-bytes: %w", err)
+		}
+		if config.MaxLengthBytes < 0 {
+			return config, errors.New("--tap-max-length-bytes must not be negative")
+		}
+	}
+	if args["--tap-message-ttl"] != nil {
+		if config.MessageTTL, err = time.ParseDuration(args["--tap-message-ttl"].(string)); err != nil {
+			return config, fmt.Errorf("--tap-message-ttl: %w", err)
+		}
+		if config.MessageTTL < 0 {
+			return config, errors.New("--tap-message-ttl must not be negative")
+		}
+		// the TTL is declared in milliseconds, a TTL of 0 expires all messages
+		if config.MessageTTL > 0 && config.MessageTTL < time.Millisecond {
+			return config, errors.New("--tap-message-ttl must be at least 1ms")
+		}
+	}
+	// with --tap-queue no tap queue is declared, which could be bounded
+	if config.Queue != "" && config.IsBounded() {
+		return config, errors.New("--tap-max-length, --tap-max-length-bytes and --tap-message-ttl can not be used with --tap-queue")
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("--tap-name-template: %w", err)
+	}
+	return config, nil
+}
+
+// parseTapAllExchangesArgs parses the arguments of the tap --all-exchanges
+// command, which taps all exchanges of a vhost passing the exchange filter.
+func parseTapAllExchangesArgs(args map[string]interface{}, amqpURLs []string, result CommandLineArgs) (CommandLineArgs, error) {
+	if result.APIURL == nil {
+		return result, fmt.Errorf("--api omitted but RABTAP_APIURI not set in environment")
+	}
+	amqpURL, err := getAMQPURL(amqpURLs, 0)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse AMQP URL: %w", err)
+	}
+	result.AllExchanges = true
+	result.ExchangeFilter = args["--exchange-filter"].(string)
+	result.TapConfig = []rabtap.TapConfiguration{{AMQPURL: amqpURL}}
+	if rescan := args["--rescan"]; rescan != nil {
+		result.RescanInterval, err = time.ParseDuration(rescan.(string))
+		if err != nil {
+			return result, fmt.Errorf("failed to parse --rescan: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// parseTapFirehoseArgs parses the arguments of the tap --firehose command,
+// which taps the FireHose exchange with a binding per requested event.
+func parseTapFirehoseArgs(args map[string]interface{}, amqpURLs []string, result CommandLineArgs) (CommandLineArgs, error) {
+	if result.APIURL == nil {
+		return result, fmt.Errorf("--api omitted but RABTAP_APIURI not set in environment")
+	}
+	amqpURL, err := getAMQPURL(amqpURLs, 0)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse AMQP URL: %w", err)
+	}
+	var exchanges []rabtap.ExchangeConfiguration
+	for _, event := range strings.Split(args["--events"].(string), ",") {
+		event = strings.TrimSpace(event)
+		if event != rabtap.FireHoseEventPublish && event != rabtap.FireHoseEventDeliver &&
+			!strings.HasPrefix(event, rabtap.FireHoseEventPublish+".") &&
+			!strings.HasPrefix(event, rabtap.FireHoseEventDeliver+".") {
+			return result, fmt.Errorf("invalid firehose event: %q", event)
+		}
+		exchanges = append(exchanges, rabtap.ExchangeConfiguration{
+			Exchange:   rabtap.FireHoseExchange,
+			BindingKey: rabtap.FireHoseBindingKey(event),
+		})
+	}
+	result.Firehose = true
+	result.TapConfig = []rabtap.TapConfiguration{{AMQPURL: amqpURL, Exchanges: exchanges}}
+	return result, nil
+}
+
 func parseHelpCmdArgs(args map[string]interface{}) (CommandLineArgs, error) {
 	result := CommandLineArgs{Cmd: HelpCmd}
 
@@ -768,6 +1489,8 @@ func parseCommandLineArgsWithSpec(spec string, cliArgs []string) (CommandLineArg
 	switch {
 	case args["--version"].(bool):
 		return CommandLineArgs{Cmd: VersionCmd}, nil
+	case args["tap"].(int) > 0 && args["cleanup"].(bool):
+		return parseTapCleanupCmdArgs(args)
 	case args["tap"].(int) > 0:
 		return parseTapCmdArgs(args)
 	case args["info"].(bool):
@@ -778,6 +1501,14 @@ func parseCommandLineArgsWithSpec(spec string, cliArgs []string) (CommandLineArg
 		return parseSubCmdArgs(args)
 	case args["queue"].(bool):
 		return parseQueueCmdArgs(args)
+	case args["rpc"].(bool):
+		return parseRPCCmdArgs(args)
+	case args["respond"].(bool):
+		return parseRespondCmdArgs(args)
+	case args["move"].(bool):
+		return parseMoveCmdArgs(args)
+	case args["mirror"].(bool):
+		return parseMirrorCmdArgs(args)
 	case args["exchange"].(bool):
 		return parseExchangeCmdArgs(args)
 	case args["conn"].(bool):
@@ -826,6 +1557,7 @@ func ParseCommandLineArgs(args []string) (CommandLineArgs, error) {
 func toDocoptDSL(usage string) string {
 	replacer := strings.NewReplacer(
 		"[TLSOPTIONS]", tlsOptions,
+		"[TAPOPTIONS]", tapOptions,
 		"[COMMON OPTIONS]", commonOptions,
 	)
 	return replacer.Replace(usage)
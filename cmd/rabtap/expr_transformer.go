@@ -0,0 +1,167 @@
+// transform messages using expressions
+// Copyright (C) 2026 Jan Delgado
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+)
+
+// NewExprTransformer creates a MessageTransformer from a transformation of
+// the form FIELD=EXPR, which sets the field of the message to the result of
+// the expression. The expression is evaluated in the same environment as the
+// filter of the subscribe command. Fields are Body, Body.PATH (a field of a
+// JSON body, e.g. Body.order.id), Exchange, RoutingKey, Header.NAME or the
+// name of a message property, e.g. ContentType, case-insensitive.
+func NewExprTransformer(transformation string) (MessageTransformer, error) {
+	target, exprstr, found := strings.Cut(transformation, "=")
+	target = strings.TrimSpace(target)
+	if !found || target == "" {
+		return nil, fmt.Errorf("invalid transformation %q, expected FIELD=EXPR", transformation)
+	}
+	prog, err := expr.Compile(exprstr)
+	if err != nil {
+		return nil, fmt.Errorf("transform %s: %w", target, err)
+	}
+
+	count := int64(0)
+	return func(m RabtapPersistentMessage) (RabtapPersistentMessage, error) {
+		env := map[string]interface{}{"r": createMessagePredEnv(m.ToTapMessage(), count)}
+		count++
+		value, err := expr.Run(prog, env)
+		if err != nil {
+			return RabtapPersistentMessage{}, fmt.Errorf("transform %s: %w", target, err)
+		}
+		if err := setMessageField(&m, target, value); err != nil {
+			return RabtapPersistentMessage{}, fmt.Errorf("transform %s: %w", target, err)
+		}
+		return m, nil
+	}, nil
+}
+
+// setMessageField sets the given field of the message to value, see
+// NewExprTransformer for the supported fields
+func setMessageField(m *RabtapPersistentMessage, target string, value interface{}) error {
+	field := strings.ToLower(target)
+	switch {
+	case field == "body":
+		body, err := toBody(value)
+		if err != nil {
+			return err
+		}
+		m.Body = body
+		return nil
+	case strings.HasPrefix(field, "body."):
+		body, err := setJSONBodyField(m.Body, target[len("body."):], value)
+		if err != nil {
+			return err
+		}
+		m.Body = body
+		return nil
+	case strings.HasPrefix(field, "header."):
+		// the headers may be shared with other messages, e.g. when repeated
+		m.Headers = maps.Clone(m.Headers)
+		if m.Headers == nil {
+			m.Headers = map[string]interface{}{}
+		}
+		name := target[len("header."):]
+		if value == nil {
+			delete(m.Headers, name)
+		} else {
+			m.Headers[name] = fromJSONNumbers(value)
+		}
+		return nil
+	}
+
+	if ts, ok := value.(time.Time); ok {
+		value = ts.Format(time.RFC3339)
+	}
+	str, err := recordValueToString(value)
+	if err != nil {
+		return err
+	}
+	switch field {
+	case "exchange":
+		m.Exchange = str
+	case "routingkey":
+		m.RoutingKey = str
+	default:
+		props, err := parseMessageProperties(map[string]string{target: str})
+		if err != nil {
+			return err
+		}
+		m.WithProperties(props)
+	}
+	return nil
+}
+
+// toBody converts the result of an expression to a message body. Strings
+// and byte slices are used as-is, nil results in an empty body and any other
+// value is JSON encoded.
+func toBody(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return []byte{}, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return json.Marshal(value)
+}
+
+// setJSONBodyField sets the field at the given path of the JSON document
+// in body to value and returns the modified document. An empty body is
+// treated as an empty JSON object.
+func setJSONBodyField(body []byte, path string, value interface{}) ([]byte, error) {
+	var doc interface{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber() // keep numbers as they are, e.g. large ints
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("decode JSON body: %w", err)
+		}
+	}
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	doc, err := setJSONPath(doc, strings.Split(path, "."), value)
+	if err != nil {
+		return nil, fmt.Errorf("path %q: %w", path, err)
+	}
+	return json.Marshal(doc)
+}
+
+// setJSONPath sets the value at the given path of a JSON document, creating
+// missing objects on the way, and returns the modified document
+func setJSONPath(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch v := doc.(type) {
+	case nil:
+		child, err := setJSONPath(nil, path[1:], value)
+		return map[string]interface{}{path[0]: child}, err
+	case map[string]interface{}:
+		child, err := setJSONPath(v[path[0]], path[1:], value)
+		v[path[0]] = child
+		return v, err
+	case []interface{}:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, fmt.Errorf("invalid array index %s", path[0])
+		}
+		v[i], err = setJSONPath(v[i], path[1:], value)
+		return v, err
+	}
+	return nil, errors.New("not a JSON object or array")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func transform(t *testing.T, transformation string, m RabtapPersistentMessage) (RabtapPersistentMessage, error) {
+	transformer, err := NewExprTransformer(transformation)
+	require.NoError(t, err)
+	return transformer(m)
+}
+
+func TestExprTransformerSetsExchangeAndRoutingKey(t *testing.T) {
+	m := RabtapPersistentMessage{Exchange: "prod.orders", RoutingKey: "eu.order"}
+
+	m, err := transform(t, `Exchange=replace(r.msg.Exchange, "prod.", "test.")`, m)
+	require.NoError(t, err)
+	m, err = transform(t, `routingkey="test." + r.msg.RoutingKey`, m)
+	require.NoError(t, err)
+
+	assert.Equal(t, "test.orders", m.Exchange)
+	assert.Equal(t, "test.eu.order", m.RoutingKey)
+}
+
+func TestExprTransformerSetsAndRemovesHeaders(t *testing.T) {
+	headers := map[string]interface{}{"tenant": "t1", "trace": "x"}
+	m := RabtapPersistentMessage{Headers: headers}
+
+	m, err := transform(t, `Header.tenant=r.msg.Headers.tenant == "t1" ? "t2" : "t3"`, m)
+	require.NoError(t, err)
+	m, err = transform(t, `Header.trace=nil`, m)
+	require.NoError(t, err)
+	m, err = transform(t, `Header.Count=r.count + 1`, m)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{"tenant": "t2", "Count": 1}, m.Headers)
+	// the original headers are left untouched
+	assert.Equal(t, map[string]interface{}{"tenant": "t1", "trace": "x"}, headers)
+}
+
+func TestExprTransformerSetsProperties(t *testing.T) {
+	ts := time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)
+	m := RabtapPersistentMessage{Timestamp: ts}
+
+	m, err := transform(t, `ContentType="application/json"`, m)
+	require.NoError(t, err)
+	m, err = transform(t, `Priority=3`, m)
+	require.NoError(t, err)
+	m, err = transform(t, `Timestamp=r.msg.Timestamp.Add(duration("1h"))`, m)
+	require.NoError(t, err)
+
+	assert.Equal(t, "application/json", m.ContentType)
+	assert.Equal(t, uint8(3), m.Priority)
+	assert.Equal(t, ts.Add(time.Hour), m.Timestamp)
+}
+
+func TestExprTransformerSetsBody(t *testing.T) {
+	m := RabtapPersistentMessage{Body: []byte("hello")}
+
+	m, err := transform(t, `Body=upper(r.toStr(r.msg.Body))`, m)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("HELLO"), m.Body)
+
+	m, err = transform(t, `Body={"n": 1}`, m)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"n": 1}`, string(m.Body))
+}
+
+func TestExprTransformerSetsFieldsOfJSONBody(t *testing.T) {
+	m := RabtapPersistentMessage{Body: []byte(`{"tenant": {"id": "t1"}, "items": [{"qty": 12345678901234567890}]}`)}
+
+	m, err := transform(t, `Body.tenant.id=fromJSON(r.toStr(r.msg.Body)).tenant.id + "-test"`, m)
+	require.NoError(t, err)
+	m, err = transform(t, `Body.items.0.sku="abc"`, m)
+	require.NoError(t, err)
+	m, err = transform(t, `Body.meta.replayed=true`, m)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"tenant": {"id": "t1-test"},
+		"items": [{"qty": 12345678901234567890, "sku": "abc"}],
+		"meta": {"replayed": true}}`, string(m.Body))
+}
+
+func TestExprTransformerFailsOnInvalidJSONBody(t *testing.T) {
+	_, err := transform(t, `Body.id=1`, RabtapPersistentMessage{Body: []byte("hello")})
+
+	assert.ErrorContains(t, err, "transform Body.id: decode JSON body")
+}
+
+func TestExprTransformerFailsOnUnknownProperty(t *testing.T) {
+	_, err := transform(t, `Unknown="x"`, RabtapPersistentMessage{})
+
+	assert.ErrorContains(t, err, "transform Unknown: unknown property")
+}
+
+func TestNewExprTransformerFailsOnInvalidTransformation(t *testing.T) {
+	for _, transformation := range []string{"Body", "=1", "Body=("} {
+		_, err := NewExprTransformer(transformation)
+		assert.Error(t, err, transformation)
+	}
+}
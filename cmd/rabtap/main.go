@@ -6,6 +6,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
@@ -78,8 +79,11 @@ func startCmdInfo(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Conf
 // createMessageReaderForPublish returns a message source that reads
 // messages from the given source in the specified format. The source can
 // be either empty (=stdin), a filename or a directory name
-func newPublishMessageSource(source *string, format string) (MessageSource, error) {
+func newPublishMessageSource(source *string, format string, mapping FieldMapping) (MessageSource, error) {
 	if source == nil {
+		if IsRecordFormat(format) {
+			return NewRecordMessageSource(format, os.Stdin, mapping)
+		}
 		return NewReaderMessageSource(format, os.Stdin)
 	}
 
@@ -93,9 +97,21 @@ func newPublishMessageSource(source *string, format string) (MessageSource, erro
 		if err != nil {
 			return nil, fmt.Errorf("open message source file: %w", err)
 		}
-		// TODO close file
-		return NewReaderMessageSource(format, file)
+		var reader MessageSource
+		if IsRecordFormat(format) {
+			reader, err = NewRecordMessageSource(format, file, mapping)
+		} else {
+			reader, err = NewReaderMessageSource(format, file)
+		}
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		return NewClosingMessageSource(reader, file), nil
 	} else {
+		if IsRecordFormat(format) {
+			return nil, fmt.Errorf("format %s can not be read from a directory", format)
+		}
 
 		metadataFiles, err := LoadMetadataFilesFromDir(*source, os.ReadDir, NewRabtapFileInfoPredicate())
 		if err != nil {
@@ -111,29 +127,82 @@ func newPublishMessageSource(source *string, format string) (MessageSource, erro
 	}
 }
 
-func startCmdPublish(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Config, logger *slog.Logger) error {
-	if args.Format == "raw" && args.PubExchange == nil && args.PubRoutingKey == nil {
+// newGeneratingMessageSource returns a MessageSource generating count
+// messages from the template file, optionally passing the values of the data
+// file to the template.
+func newGeneratingMessageSource(templateFile string, dataFile *string, count int) (MessageSource, error) {
+	tpl, err := LoadMessageTemplate(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if dataFile != nil {
+		if data, err = LoadTemplateData(*dataFile); err != nil {
+			return nil, err
+		}
+	}
+	return NewGeneratingMessageSource(tpl, count, data), nil
+}
+
+func startCmdPublish(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Config, out *os.File, logger *slog.Logger) error {
+	if args.Format == "raw" && args.GenerateTemplate == nil && args.PubExchange == nil && args.PubRoutingKey == nil {
 		logger.Warn("using raw message format but neither exchange or routing key are set.")
 	}
-	source, err := newPublishMessageSource(args.Source, args.Format)
+	// open creates the message source, which is re-opened for every
+	// repetition, i.e. files are read again and messages generated again.
+	open := func() (MessageSource, error) {
+		if args.GenerateTemplate != nil {
+			return newGeneratingMessageSource(*args.GenerateTemplate, args.TemplateData, args.Count)
+		}
+		return newPublishMessageSource(args.Source, args.Format, args.FieldMapping)
+	}
+	source, err := open()
 	if err != nil {
 		return fmt.Errorf("message source: %w", err)
 	}
-	source = NewTransformingMessageSource(source,
-		FireHoseTransformer,
-		NewPropertiesTransformer(args.Properties))
+	if args.Repeat != 1 {
+		reopen := open
+		if args.GenerateTemplate == nil && args.Source == nil {
+			// stdin can be read only once, so keep the messages in memory
+			source, reopen = NewReplayableMessageSource(source)
+		}
+		source = NewRepeatingMessageSource(source, reopen, args.Repeat)
+	}
+	filterPred, err := NewExprPredicate(args.Filter)
+	if err != nil {
+		return fmt.Errorf("message filter predicate: %w", err)
+	}
+	transformers := []MessageTransformer{NewPropertiesTransformer(args.Properties)}
+	for _, transformation := range args.Transforms {
+		transformer, err := NewExprTransformer(transformation)
+		if err != nil {
+			return fmt.Errorf("message transformation: %w", err)
+		}
+		transformers = append(transformers, transformer)
+	}
+	// filter messages as recorded, before they are transformed
+	source = NewTransformingMessageSource(source, FireHoseTransformer)
+	source = NewFilteringMessageSource(source, filterPred, logger)
+	source = NewTransformingMessageSource(source, transformers...)
 
 	return cmdPublish(ctx, CmdPublishArg{
-		amqpURL:    args.AMQPURL,
-		exchange:   args.PubExchange,
-		routingKey: args.PubRoutingKey,
-		headers:    args.Args,
-		fixedDelay: args.Delay,
-		speed:      args.Speed,
-		tlsConfig:  tlsConfig,
-		mandatory:  args.Mandatory,
-		confirms:   args.Confirms,
-		source:     source,
+		amqpURL:        args.AMQPURL,
+		exchange:       args.PubExchange,
+		routingKey:     args.PubRoutingKey,
+		headers:        args.Args,
+		fixedDelay:     args.Delay,
+		speed:          args.Speed,
+		tlsConfig:      tlsConfig,
+		mandatory:      args.Mandatory,
+		confirms:       args.Confirms,
+		confirmWindow:  args.ConfirmWindow,
+		blockedTimeout: args.BlockedTimeout,
+		txBatchSize:    args.TxBatchSize,
+		rejectFile:     args.RejectFile,
+		rate:           args.Rate,
+		summary:        args.Rate > 0 || args.Repeat != 1,
+		out:            out,
+		source:         source,
 	}, logger)
 }
 
@@ -170,10 +239,15 @@ func startCmdSubscribe(ctx context.Context, args CommandLineArgs, tlsConfig *tls
 		termPred:    termPred,
 		args:        args.Args,
 		timeout:     args.IdleTimeout,
+		prefetch:    args.Prefetch,
+		ackBatch:    args.AckBatch,
+		ackMode:     args.AckMode,
+		drain:       args.Drain,
+		ackInterval: args.AckInterval,
 	}, logger)
 }
 
-func startCmdTap(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Config, out *os.File, logger *slog.Logger) error {
+func startCmdQueuePeek(args CommandLineArgs, tlsConfig *tls.Config, out *os.File, logger *slog.Logger) error {
 	opts := MessageSinkOptions{
 		out:              NewColorableWriter(out),
 		format:           args.Format,
@@ -186,25 +260,182 @@ func startCmdTap(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Confi
 		return fmt.Errorf("create message sink: %w", err)
 	}
 
+	return cmdQueuePeek(CmdQueuePeekArg{
+		amqpURL:     args.AMQPURL,
+		queue:       args.QueueName,
+		count:       args.Count,
+		tlsConfig:   tlsConfig,
+		messageSink: messageSink,
+		summaryOut:  os.Stderr,
+	}, logger)
+}
+
+func startCmdRPC(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Config, out *os.File, logger *slog.Logger) error {
+	source, err := newPublishMessageSource(args.Source, args.Format, nil)
+	if err != nil {
+		return fmt.Errorf("message source: %w", err)
+	}
+	source = NewTransformingMessageSource(source, NewPropertiesTransformer(args.Properties))
+
+	opts := MessageSinkOptions{
+		out:              NewColorableWriter(out),
+		format:           args.Format,
+		silent:           args.Silent,
+		optSaveDir:       args.SaveDir,
+		filenameProvider: defaultFilenameProvider,
+	}
+	messageSink, err := NewMessageSink(opts)
+	if err != nil {
+		return fmt.Errorf("create message sink: %w", err)
+	}
+
+	return cmdRPC(ctx, CmdRPCArg{
+		amqpURL:        args.AMQPURL,
+		tlsConfig:      tlsConfig,
+		exchange:       args.PubExchange,
+		routingKey:     args.PubRoutingKey,
+		headers:        args.Args,
+		source:         source,
+		tempReplyQueue: args.TempReplyQueue,
+		timeout:        args.ReplyTimeout,
+		messageSink:    messageSink,
+	}, logger)
+}
+
+func startCmdRespond(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Config, out *os.File, logger *slog.Logger) error {
+	replies, err := loadRecordedReplies(args.RepliesDir, args.Format)
+	if err != nil {
+		return fmt.Errorf("recorded replies: %w", err)
+	}
 	termPred, err := NewLoopCountPred(args.Limit)
 	if err != nil {
 		return fmt.Errorf("message limit predicate: %w", err)
 	}
+	var delay time.Duration
+	if args.Delay != nil {
+		delay = *args.Delay
+	}
+
+	return cmdRespond(ctx, CmdRespondArg{
+		amqpURL:   args.AMQPURL,
+		tlsConfig: tlsConfig,
+		queue:     args.QueueName,
+		replies:   replies,
+		delay:     delay,
+		termPred:  termPred,
+		timeout:   args.IdleTimeout,
+		out:       out,
+	}, logger)
+}
 
+func startCmdMove(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Config, out *os.File, logger *slog.Logger) error {
+	termPred, err := NewLoopCountPred(args.Limit)
+	if err != nil {
+		return fmt.Errorf("message limit predicate: %w", err)
+	}
 	filterPred, err := NewExprPredicate(args.Filter)
 	if err != nil {
 		return fmt.Errorf("message filter predicate: %w", err)
 	}
 
-	return cmdTap(ctx,
-		CmdTapArg{
-			tapConfig:   args.TapConfig,
-			tlsConfig:   tlsConfig,
-			messageSink: messageSink,
-			filterPred:  filterPred,
-			termPred:    termPred,
-			timeout:     args.IdleTimeout,
-		}, logger)
+	exchange := ""
+	if args.PubExchange != nil {
+		exchange = *args.PubExchange
+	}
+	return cmdMove(ctx, CmdMoveArg{
+		amqpURL:    args.AMQPURL,
+		toURL:      args.ToAMQPURL,
+		tlsConfig:  tlsConfig,
+		queue:      args.QueueName,
+		exchange:   exchange,
+		toOrigin:   args.ToOrigin,
+		routingKey: args.PubRoutingKey,
+		headers:    args.Args,
+		properties: args.Properties,
+		filterPred: filterPred,
+		termPred:   termPred,
+		ackMode:    args.AckMode,
+		prefetch:   args.Prefetch,
+		timeout:    args.IdleTimeout,
+		out:        out,
+	}, logger)
+}
+
+// newCmdTapArg creates the arguments of the tap command, which are also
+// used by the mirror command. The messageSink is not set.
+func newCmdTapArg(args CommandLineArgs, tlsConfig *tls.Config) (CmdTapArg, error) {
+	termPred, err := NewLoopCountPred(args.Limit)
+	if err != nil {
+		return CmdTapArg{}, fmt.Errorf("message limit predicate: %w", err)
+	}
+
+	filterPred, err := NewExprPredicate(args.Filter)
+	if err != nil {
+		return CmdTapArg{}, fmt.Errorf("message filter predicate: %w", err)
+	}
+
+	var apiClient *rabtap.RabbitHTTPClient
+	if args.APIURL != nil {
+		apiClient = rabtap.NewRabbitHTTPClient(args.APIURL, tlsConfig)
+	}
+
+	var exchangeFilter Predicate
+	if args.AllExchanges {
+		if exchangeFilter, err = NewExprPredicate(args.ExchangeFilter); err != nil {
+			return CmdTapArg{}, fmt.Errorf("exchange filter predicate: %w", err)
+		}
+	}
+
+	return CmdTapArg{
+		tapConfig:      args.TapConfig,
+		apiClient:      apiClient,
+		exchangeFilter: exchangeFilter,
+		rescanInterval: args.RescanInterval,
+		firehose:       args.Firehose,
+		dedupWindow:    args.DedupWindow,
+		tapSetup:       args.TapSetup,
+		tlsConfig:      tlsConfig,
+		filterPred:     filterPred,
+		termPred:       termPred,
+		timeout:        args.IdleTimeout,
+	}, nil
+}
+
+func startCmdTap(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Config, out *os.File, logger *slog.Logger) error {
+	opts := MessageSinkOptions{
+		out:              NewColorableWriter(out),
+		format:           args.Format,
+		silent:           args.Silent,
+		optSaveDir:       args.SaveDir,
+		filenameProvider: defaultFilenameProvider,
+	}
+	messageSink, err := NewMessageSink(opts)
+	if err != nil {
+		return fmt.Errorf("create message sink: %w", err)
+	}
+
+	tap, err := newCmdTapArg(args, tlsConfig)
+	if err != nil {
+		return err
+	}
+	tap.messageSink = messageSink
+	return cmdTap(ctx, tap, logger)
+}
+
+func startCmdMirror(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Config, out *os.File, logger *slog.Logger) error {
+	tap, err := newCmdTapArg(args, tlsConfig)
+	if err != nil {
+		return err
+	}
+	return cmdMirror(ctx, CmdMirrorArg{
+		tap:       tap,
+		toURL:     args.ToAMQPURL,
+		tlsConfig: tlsConfig,
+		renames:   args.ExchangeRenames,
+		rate:      args.Rate,
+		sample:    args.SampleRatio,
+		out:       out,
+	}, logger)
 }
 
 func dispatchCmd(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Config, out *os.File, logger *slog.Logger) error {
@@ -226,7 +457,15 @@ func dispatchCmd(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Confi
 	case SubCmd:
 		return startCmdSubscribe(ctx, args, tlsConfig, out, logger)
 	case PubCmd:
-		return startCmdPublish(ctx, args, tlsConfig, logger)
+		return startCmdPublish(ctx, args, tlsConfig, out, logger)
+	case RPCCmd:
+		return startCmdRPC(ctx, args, tlsConfig, out, logger)
+	case RespondCmd:
+		return startCmdRespond(ctx, args, tlsConfig, out, logger)
+	case MoveCmd:
+		return startCmdMove(ctx, args, tlsConfig, out, logger)
+	case MirrorCmd:
+		return startCmdMirror(ctx, args, tlsConfig, out, logger)
 	case TapCmd:
 		return startCmdTap(ctx, args, tlsConfig, out, logger)
 	case ExchangeCreateCmd:
@@ -261,6 +500,8 @@ func dispatchCmd(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Confi
 		return cmdQueueRemove(args.AMQPURL, args.QueueName, tlsConfig, logger)
 	case QueuePurgeCmd:
 		return cmdQueuePurge(args.AMQPURL, args.QueueName, tlsConfig, logger)
+	case QueuePeekCmd:
+		return startCmdQueuePeek(args, tlsConfig, out, logger)
 	case QueueBindCmd:
 		return cmdQueueBindToExchange(CmdQueueBindArg{
 			amqpURL:  args.AMQPURL,
@@ -280,11 +521,24 @@ func dispatchCmd(ctx context.Context, args CommandLineArgs, tlsConfig *tls.Confi
 	case ConnCloseCmd:
 		return cmdConnClose(ctx, args.APIURL, args.ConnName,
 			args.CloseReason, tlsConfig)
+	case TapCleanupCmd:
+		return cmdTapCleanup(ctx, CmdTapCleanupArg{
+			apiClient:  rabtap.NewRabbitHTTPClient(args.APIURL, tlsConfig),
+			vhost:      args.Vhost,
+			naming:     args.TapSetup,
+			minIdle:    args.MinIdle,
+			settleTime: TapCleanupSettleTime,
+			dryRun:     args.DryRun,
+			out:        NewColorableWriter(out),
+		}, logger)
 	default:
 		return fmt.Errorf("unknown command %+v", args.Cmd)
 	}
 }
 
+// exitCodeTimeout is returned when the rpc command received no reply in time
+const exitCodeTimeout = 2
+
 func main() {
 	rabtapMain(os.Stdout)
 }
@@ -331,6 +585,9 @@ func rabtapMain(out *os.File) {
 	err = dispatchCmd(ctx, args, tlsConfig, out, logger)
 	if err != nil {
 		logger.Error("command failed", "error", err)
+		if errors.Is(err, rabtap.ErrReplyTimeout) {
+			os.Exit(exitCodeTimeout)
+		}
 		os.Exit(1)
 	}
 }
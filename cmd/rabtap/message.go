@@ -36,6 +36,14 @@ type RabtapPersistentMessage struct {
 
 	// rabtap specific fields
 	XRabtapReceivedTimestamp time.Time
+	XRabtapTraceEvent        string `json:",omitempty"` // firehose: publish or deliver
+	XRabtapTraceQueue        string `json:",omitempty"` // firehose: queue of deliver event
+	XRabtapSourceBroker      string `json:",omitempty"` // tap: broker the message was tapped on
+	XRabtapSourceExchange    string `json:",omitempty"` // tap: tapped exchange
+	XRabtapSourceBindingKey  string `json:",omitempty"` // tap: binding key of the tap
+	XRabtapPaths             int    `json:",omitempty"` // tap: number of taps the message was received by
+	XRabtapReplyIf           string `json:",omitempty"` // respond: predicate selecting the requests to send this reply for
+	XRabtapReplyDelay        string `json:",omitempty"` // respond: duration to wait before sending this reply
 
 	// will be serialized as base64
 	Body []byte
@@ -60,6 +68,14 @@ type PropertiesOverride struct {
 // from a rabtap.TapMessage
 func NewRabtapPersistentMessage(message rabtap.TapMessage) RabtapPersistentMessage {
 	m := message.AmqpMessage
+	var traceEvent, traceQueue string
+	if message.Trace != nil {
+		traceEvent, traceQueue = message.Trace.Event, message.Trace.Queue
+	}
+	var source rabtap.TapSource
+	if message.Source != nil {
+		source = *message.Source
+	}
 	return RabtapPersistentMessage{
 		Headers:                  m.Headers,
 		ContentType:              m.ContentType,
@@ -78,6 +94,12 @@ func NewRabtapPersistentMessage(message rabtap.TapMessage) RabtapPersistentMessa
 		Exchange:                 m.Exchange,
 		RoutingKey:               m.RoutingKey,
 		XRabtapReceivedTimestamp: message.ReceivedTimestamp,
+		XRabtapTraceEvent:        traceEvent,
+		XRabtapTraceQueue:        traceQueue,
+		XRabtapSourceBroker:      source.BrokerURL,
+		XRabtapSourceExchange:    source.Exchange,
+		XRabtapSourceBindingKey:  source.BindingKey,
+		XRabtapPaths:             message.Paths,
 		Body:                     m.Body,
 	}
 }
@@ -140,3 +162,42 @@ func (s *RabtapPersistentMessage) WithProperties(props PropertiesOverride) *Rabt
 	}
 	return s
 }
+
+// ToTapMessage converts message to a rabtap.TapMessage, e.g. to evaluate
+// filter expressions on messages to be published
+func (s *RabtapPersistentMessage) ToTapMessage() rabtap.TapMessage {
+	message := rabtap.TapMessage{
+		AmqpMessage: &amqp.Delivery{
+			Headers:         s.Headers,
+			ContentType:     s.ContentType,
+			ContentEncoding: s.ContentEncoding,
+			DeliveryMode:    s.DeliveryMode,
+			Priority:        s.Priority,
+			CorrelationId:   s.CorrelationID,
+			ReplyTo:         s.ReplyTo,
+			Expiration:      s.Expiration,
+			MessageId:       s.MessageID,
+			Timestamp:       s.Timestamp,
+			Type:            s.Type,
+			UserId:          s.UserID,
+			AppId:           s.AppID,
+			DeliveryTag:     s.DeliveryTag,
+			Redelivered:     s.Redelivered,
+			Exchange:        s.Exchange,
+			RoutingKey:      s.RoutingKey,
+			Body:            s.Body},
+		ReceivedTimestamp: s.XRabtapReceivedTimestamp,
+		Paths:             s.XRabtapPaths,
+	}
+	if s.XRabtapTraceEvent != "" {
+		message.Trace = &rabtap.TraceInfo{Event: s.XRabtapTraceEvent, Queue: s.XRabtapTraceQueue}
+	}
+	if s.XRabtapSourceExchange != "" {
+		message.Source = &rabtap.TapSource{
+			BrokerURL:  s.XRabtapSourceBroker,
+			Exchange:   s.XRabtapSourceExchange,
+			BindingKey: s.XRabtapSourceBindingKey,
+		}
+	}
+	return message
+}
@@ -0,0 +1,120 @@
+// generate messages from a template
+// Copyright (C) 2026 Jan Delgado
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"text/template"
+	"time"
+	"uuid"
+)
+
+// generatorContext is passed to the template when rendering a message
+type generatorContext struct {
+	Seq       int         // sequence number of the message, starting with 1
+	Count     int         // total number of messages to generate
+	Timestamp time.Time   // time the message is rendered
+	Data      interface{} // values loaded from the data file, if any
+}
+
+// generatedMessage is a message rendered from a template. Unlike in the rabtap
+// JSON message format, the body is not base64 encoded: a JSON string is used
+// as-is, any other JSON value (e.g. an object) is used as JSON encoded body.
+type generatedMessage struct {
+	RabtapPersistentMessage
+	Body json.RawMessage
+}
+
+// generatorTemplateFuncs are the functions available in message templates
+var generatorTemplateFuncs = template.FuncMap{
+	// UUID returns a random UUID
+	"UUID": func() string { return uuid.New().String() },
+	// RandInt returns a random int in the interval [min, max)
+	"RandInt": func(min, max int) int { return min + rand.IntN(max-min) },
+	// Pick returns a random element of the given list
+	"Pick": func(list []interface{}) interface{} { return list[rand.IntN(len(list))] },
+	// JSON encodes the given value as JSON, e.g. to quote a string
+	"JSON": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// NewMessageTemplate parses the given message template
+func NewMessageTemplate(name, tpl string) (*template.Template, error) {
+	return template.New(name).Funcs(generatorTemplateFuncs).Option("missingkey=error").Parse(tpl)
+}
+
+// LoadMessageTemplate loads and parses the message template from the given file
+func LoadMessageTemplate(filename string) (*template.Template, error) {
+	tpl, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read template: %w", err)
+	}
+	return NewMessageTemplate(filename, string(tpl))
+}
+
+// LoadTemplateData loads the JSON encoded values passed to a template as .Data
+func LoadTemplateData(filename string) (interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read template data: %w", err)
+	}
+	var values interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parse template data %s: %w", filename, err)
+	}
+	return values, nil
+}
+
+// renderMessage renders a message from the template. The template must
+// render a message in rabtap JSON message format, with the body as described
+// in generatedMessage.
+func renderMessage(tpl *template.Template, ctx generatorContext) (RabtapPersistentMessage, error) {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, ctx); err != nil {
+		return RabtapPersistentMessage{}, fmt.Errorf("render message %d: %w", ctx.Seq, err)
+	}
+	decoder := json.NewDecoder(&buf)
+	decoder.UseNumber() // decode numbers as json.Number, not float64
+	var msg generatedMessage
+	if err := decoder.Decode(&msg); err != nil {
+		return RabtapPersistentMessage{}, fmt.Errorf("decode rendered message %d: %w", ctx.Seq, err)
+	}
+
+	result := msg.RabtapPersistentMessage
+	result.Body = msg.Body
+	if bytes.HasPrefix(msg.Body, []byte(`"`)) {
+		var body string
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return RabtapPersistentMessage{}, fmt.Errorf("decode body of message %d: %w", ctx.Seq, err)
+		}
+		result.Body = []byte(body)
+	}
+	return result, nil
+}
+
+// NewGeneratingMessageSource returns a MessageSource that provides count
+// messages rendered from the given template, which is passed a
+// generatorContext with the given data.
+func NewGeneratingMessageSource(tpl *template.Template, count int, data interface{}) MessageSource {
+	seq := 0
+	return func() (RabtapPersistentMessage, error) {
+		if seq >= count {
+			return RabtapPersistentMessage{}, io.EOF
+		}
+		seq++
+		return renderMessage(tpl, generatorContext{
+			Seq:       seq,
+			Count:     count,
+			Timestamp: time.Now(),
+			Data:      data,
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGeneratingMessageSource(t *testing.T, tpl string) MessageSource {
+	tmpl, err := NewMessageTemplate("test", tpl)
+	require.NoError(t, err)
+	return NewGeneratingMessageSource(tmpl, 2, map[string]interface{}{"names": []interface{}{"alice"}})
+}
+
+func TestGeneratingMessageSourceRendersCountMessages(t *testing.T) {
+	source := newTestGeneratingMessageSource(t, `{
+		"RoutingKey": "orders.{{ .Seq }}",
+		"Headers": {"id": "{{ .Seq }}/{{ .Count }}"},
+		"ContentType": "text/plain",
+		"Body": "hello {{ Pick .Data.names }}"
+	}`)
+
+	for _, seq := range []string{"1", "2"} {
+		msg, err := source()
+		require.NoError(t, err)
+		assert.Equal(t, "orders."+seq, msg.RoutingKey)
+		assert.Equal(t, seq+"/2", msg.Headers["id"])
+		assert.Equal(t, "text/plain", msg.ContentType)
+		assert.Equal(t, []byte("hello alice"), msg.Body)
+	}
+	_, err := source()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestGeneratingMessageSourceUsesJSONValueAsBody(t *testing.T) {
+	source := newTestGeneratingMessageSource(t, `{"Body": {"seq": {{ .Seq }}, "name": {{ JSON "a \"b\"" }}}}`)
+
+	msg, err := source()
+
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"seq": 1, "name": "a \"b\""}`, string(msg.Body))
+}
+
+func TestGeneratingMessageSourceProvidesRandomHelpers(t *testing.T) {
+	source := newTestGeneratingMessageSource(t, `{"MessageID": "{{ UUID }}", "Body": "{{ RandInt 5 6 }}"}`)
+
+	msg, err := source()
+
+	require.NoError(t, err)
+	assert.Len(t, msg.MessageID, 36)
+	assert.Equal(t, []byte("5"), msg.Body)
+}
+
+func TestGeneratingMessageSourceFailsOnInvalidRenderedMessage(t *testing.T) {
+	source := newTestGeneratingMessageSource(t, `{"Body": {{ .Seq }}`)
+
+	_, err := source()
+
+	assert.ErrorContains(t, err, "decode rendered message 1")
+}
+
+func TestGeneratingMessageSourceFailsOnMissingData(t *testing.T) {
+	source := newTestGeneratingMessageSource(t, `{"Body": "{{ .Data.unknown }}"}`)
+
+	_, err := source()
+
+	assert.ErrorContains(t, err, "render message 1")
+}
+
+func TestLoadTemplateDataLoadsJSONFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.json")
+	require.NoError(t, os.WriteFile(filename, []byte(`{"names": ["alice", "bob"]}`), 0o600))
+
+	data, err := LoadTemplateData(filename)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"names": []interface{}{"alice", "bob"}}, data)
+}
+
+func TestLoadTemplateDataFailsOnInvalidJSON(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.json")
+	require.NoError(t, os.WriteFile(filename, []byte(`{`), 0o600))
+
+	_, err := LoadTemplateData(filename)
+
+	assert.Error(t, err)
+}
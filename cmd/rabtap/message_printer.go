@@ -7,11 +7,22 @@ import (
 	"text/template"
 
 	rabtap "github.com/jandelgado/rabtap/pkg"
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 // messageTemplate is the default template to print a message
 // TODO allow externalization of template
 const messageTemplate = `------ message received on {{ .Message.ReceivedTimestamp.Format "2006-01-02T15:04:05Z07:00" }} ------
+{{with .Message.Trace}}trace-event....: {{.Event}}
+{{with .Queue}}trace-queue....: {{ QueueColor .}}
+{{end}}{{with .RoutedQueues}}routed-queues..: {{range $i, $q := .}}{{if $i}}, {{end}}{{ QueueColor $q }}{{end}}
+{{end}}{{end -}}
+{{with .Message.Source}}source-broker..: {{.BrokerURL}}
+source-exchange: {{ ExchangeColor .Exchange }}
+{{with .BindingKey}}source-key.....: {{ KeyColor .}}
+{{end}}{{end -}}
+{{if gt .Message.Paths 1}}paths..........: {{.Message.Paths}}
+{{end -}}
 exchange.......: {{ ExchangeColor .Message.AmqpMessage.Exchange }}
 {{with .Message.AmqpMessage.RoutingKey}}routingkey.....: {{ KeyColor .}}
 {{end}}{{with .Message.AmqpMessage.Priority}}priority.......: {{.}}
@@ -25,7 +36,11 @@ exchange.......: {{ ExchangeColor .Message.AmqpMessage.Exchange }}
 {{end}}{{with .Message.AmqpMessage.ReplyTo}}reply-to.......: {{.}}
 {{end}}{{with .Message.AmqpMessage.AppId}}app-id.........: {{.}}
 {{end}}{{with .Message.AmqpMessage.UserId}}user-id........: {{.}}
-{{end}}{{with .Message.AmqpMessage.Headers}}app-headers....: {{.}}
+{{end}}{{with .Headers}}app-headers....: {{.}}
+{{end -}}
+{{with .FirstDeath}}first-death....: {{.}}
+{{end -}}
+{{range .Deaths}}dead-lettered..: {{.}}
 {{end -}}
 {{ MessageColor (call .Body) }}
 
@@ -37,6 +52,23 @@ type PrintMessageEnv struct {
 	Message rabtap.TapMessage
 	// formatted body
 	Body func() string
+	// headers of the message, without the dead-letter headers
+	Headers amqp.Table
+	// decoded dead-letter headers
+	Deaths     []rabtap.Death
+	FirstDeath *rabtap.Death
+}
+
+// withoutDeathHeaders returns the given headers without the headers set by
+// the broker when the message was dead-lettered
+func withoutDeathHeaders(headers amqp.Table) amqp.Table {
+	result := amqp.Table{}
+	for k, v := range headers {
+		if !rabtap.IsDeathHeader(k) {
+			result[k] = v
+		}
+	}
+	return result
 }
 
 // MessageBodyFormatter formats the body of a message
@@ -67,8 +99,12 @@ func PrettyPrintMessage(out io.Writer, message rabtap.TapMessage) error {
 
 	formatter := NewMessageFormatter(message.AmqpMessage.ContentType)
 
+	headers := message.AmqpMessage.Headers
 	printEnv := PrintMessageEnv{
-		Message: message,
+		Message:    message,
+		Headers:    withoutDeathHeaders(headers),
+		Deaths:     rabtap.DeathHistory(headers),
+		FirstDeath: rabtap.FirstDeath(headers),
 		Body: func() string {
 			if b, err := Body(message.AmqpMessage); err != nil {
 				// decoding failed, printing body as-is
@@ -0,0 +1,260 @@
+// read messages from records, i.e. lines, CSV rows or JSON documents
+// Copyright (C) 2026 Jan Delgado
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxLineSize is the max. size of a line read with the lines and jsonl-body
+// formats
+const maxLineSize = 64 * 1024 * 1024
+
+// FieldMapping maps fields of a message (the keys) to fields of a record (the
+// values), i.e. to the columns of a CSV row or to paths of a JSON document.
+// Message fields are Body, Exchange, RoutingKey, Header.NAME or the name of a
+// message property, e.g. ContentType, case-insensitive.
+type FieldMapping map[string]string
+
+// recordLookupFunc returns the value of the given field of a record
+type recordLookupFunc func(field string) (interface{}, error)
+
+// IsRecordFormat returns true if the given format is read by
+// NewRecordMessageSource
+func IsRecordFormat(format string) bool {
+	return format == "csv" || format == "lines" || format == "jsonl-body"
+}
+
+// recordValueToString converts a value of a record to a string. Strings are
+// used as-is, other values are JSON encoded.
+func recordValueToString(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// fromJSONNumbers converts json.Number values, which are not valid in AMQP
+// tables, to int64 or float64
+func fromJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, elem := range v {
+			m[k] = fromJSONNumbers(elem)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, elem := range v {
+			a[i] = fromJSONNumbers(elem)
+		}
+		return a
+	}
+	return value
+}
+
+// apply sets the fields of the message to the mapped fields of a record
+func (s FieldMapping) apply(msg *RabtapPersistentMessage, lookup recordLookupFunc) error {
+	props := map[string]string{}
+	for target, field := range s {
+		value, err := lookup(field)
+		if err != nil {
+			return fmt.Errorf("map %s: %w", target, err)
+		}
+		if strings.HasPrefix(strings.ToLower(target), "header.") {
+			if msg.Headers == nil {
+				msg.Headers = map[string]interface{}{}
+			}
+			msg.Headers[target[len("header."):]] = fromJSONNumbers(value)
+			continue
+		}
+		str, err := recordValueToString(value)
+		if err != nil {
+			return fmt.Errorf("map %s: %w", target, err)
+		}
+		switch strings.ToLower(target) {
+		case "body":
+			msg.Body = []byte(str)
+		case "exchange":
+			msg.Exchange = str
+		case "routingkey":
+			msg.RoutingKey = str
+		default:
+			props[target] = str
+		}
+	}
+	overrides, err := parseMessageProperties(props)
+	if err != nil {
+		return fmt.Errorf("map properties: %w", err)
+	}
+	msg.WithProperties(overrides)
+	return nil
+}
+
+// lookupJSONPath returns the value at the given path of a JSON document,
+// with the path elements separated by dots, e.g. "order.items.0.id".
+func lookupJSONPath(doc interface{}, path string) (interface{}, error) {
+	value := doc
+	for _, elem := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, ok := v[elem]
+			if !ok {
+				return nil, fmt.Errorf("path %q not found", path)
+			}
+			value = child
+		case []interface{}:
+			i, err := strconv.Atoi(elem)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("path %q not found", path)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("path %q not found", path)
+		}
+	}
+	return value, nil
+}
+
+func newLineScanner(reader io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return scanner
+}
+
+// scanLine returns the next line of the scanner or io.EOF
+func scanLine(scanner *bufio.Scanner) ([]byte, error) {
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return bytes.Clone(scanner.Bytes()), nil
+}
+
+// newLinesMessageSource returns a MessageSource providing each line as the
+// body of a message
+func newLinesMessageSource(reader io.Reader) MessageSource {
+	scanner := newLineScanner(reader)
+	return func() (RabtapPersistentMessage, error) {
+		line, err := scanLine(scanner)
+		return RabtapPersistentMessage{Body: line}, err
+	}
+}
+
+// newJSONLinesMessageSource returns a MessageSource reading a JSON document
+// per line. The body is the document, unless mapped otherwise. Empty lines
+// are skipped.
+func newJSONLinesMessageSource(reader io.Reader, mapping FieldMapping) MessageSource {
+	scanner := newLineScanner(reader)
+	lineNum := 0
+	return func() (RabtapPersistentMessage, error) {
+		for {
+			line, err := scanLine(scanner)
+			if err != nil {
+				return RabtapPersistentMessage{}, err
+			}
+			lineNum++
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			decoder := json.NewDecoder(bytes.NewReader(line))
+			decoder.UseNumber() // decode numbers as json.Number, not float64
+			var doc interface{}
+			if err := decoder.Decode(&doc); err != nil {
+				return RabtapPersistentMessage{}, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			msg := RabtapPersistentMessage{Body: line}
+			lookup := func(path string) (interface{}, error) { return lookupJSONPath(doc, path) }
+			if err := mapping.apply(&msg, lookup); err != nil {
+				return RabtapPersistentMessage{}, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			return msg, nil
+		}
+	}
+}
+
+// newCSVMessageSource returns a MessageSource reading a message per row of a
+// CSV file, whose first row contains the column names. The body is the row
+// as JSON object, unless mapped otherwise.
+func newCSVMessageSource(reader io.Reader, mapping FieldMapping) (MessageSource, error) {
+	csvReader := csv.NewReader(reader)
+	columns, err := csvReader.Read()
+	if errors.Is(err, io.EOF) {
+		return func() (RabtapPersistentMessage, error) {
+			return RabtapPersistentMessage{}, io.EOF
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read CSV header: %w", err)
+	}
+	index := map[string]int{}
+	for i, column := range columns {
+		index[column] = i
+	}
+	for target, column := range mapping {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("map %s: unknown column %q", target, column)
+		}
+	}
+
+	return func() (RabtapPersistentMessage, error) {
+		row, err := csvReader.Read()
+		if err != nil {
+			return RabtapPersistentMessage{}, err
+		}
+		line, _ := csvReader.FieldPos(0)
+		record := map[string]string{}
+		for i, column := range columns {
+			record[column] = row[i]
+		}
+		body, err := json.Marshal(record)
+		if err != nil {
+			return RabtapPersistentMessage{}, err
+		}
+		msg := RabtapPersistentMessage{Body: body}
+		lookup := func(column string) (interface{}, error) { return row[index[column]], nil }
+		if err := mapping.apply(&msg, lookup); err != nil {
+			return RabtapPersistentMessage{}, fmt.Errorf("line %d: %w", line, err)
+		}
+		return msg, nil
+	}, nil
+}
+
+// NewRecordMessageSource returns a MessageSource that reads a message per
+// record of the given reader, i.e. per line (format "lines"), per CSV row
+// (format "csv") or per JSON document on a line (format "jsonl-body"). The
+// fields of the messages are set from the records using the mapping, which is
+// not supported by the "lines" format.
+func NewRecordMessageSource(format string, reader io.Reader, mapping FieldMapping) (MessageSource, error) {
+	switch format {
+	case "lines":
+		if len(mapping) > 0 {
+			return nil, errors.New("field mapping is not supported with format lines")
+		}
+		return newLinesMessageSource(reader), nil
+	case "jsonl-body":
+		return newJSONLinesMessageSource(reader, mapping), nil
+	case "csv":
+		return newCSVMessageSource(reader, mapping)
+	}
+	return nil, fmt.Errorf("invalid format %s", format)
+}
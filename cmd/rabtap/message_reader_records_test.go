@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAllMessages(t *testing.T, source MessageSource) []RabtapPersistentMessage {
+	var messages []RabtapPersistentMessage
+	for {
+		msg, err := source()
+		if err == io.EOF {
+			return messages
+		}
+		require.NoError(t, err)
+		messages = append(messages, msg)
+	}
+}
+
+func TestRecordMessageSourceReadsLines(t *testing.T) {
+	source, err := NewRecordMessageSource("lines", strings.NewReader("hello\n\nworld\n"), nil)
+	require.NoError(t, err)
+
+	messages := readAllMessages(t, source)
+
+	require.Len(t, messages, 3)
+	assert.Equal(t, []byte("hello"), messages[0].Body)
+	assert.Equal(t, []byte{}, messages[1].Body)
+	assert.Equal(t, []byte("world"), messages[2].Body)
+}
+
+func TestRecordMessageSourceRejectsMappingForLines(t *testing.T) {
+	_, err := NewRecordMessageSource("lines", strings.NewReader(""), FieldMapping{"Body": "x"})
+	assert.Error(t, err)
+}
+
+func TestRecordMessageSourceReadsCSVRowsAsJSONObjectByDefault(t *testing.T) {
+	source, err := NewRecordMessageSource("csv", strings.NewReader("id,name\n1,alice\n2,bob\n"), nil)
+	require.NoError(t, err)
+
+	messages := readAllMessages(t, source)
+
+	require.Len(t, messages, 2)
+	assert.JSONEq(t, `{"id": "1", "name": "alice"}`, string(messages[0].Body))
+	assert.JSONEq(t, `{"id": "2", "name": "bob"}`, string(messages[1].Body))
+}
+
+func TestRecordMessageSourceMapsCSVColumns(t *testing.T) {
+	csv := "key,tenant,type,mode,payload\norders.eu,acme,order,persistent,\"{\"\"id\"\": 1}\"\n"
+	mapping := FieldMapping{
+		"RoutingKey":    "key",
+		"Header.Tenant": "tenant",
+		"Type":          "type",
+		"deliverymode":  "mode",
+		"Body":          "payload",
+	}
+	source, err := NewRecordMessageSource("csv", strings.NewReader(csv), mapping)
+	require.NoError(t, err)
+
+	messages := readAllMessages(t, source)
+
+	require.Len(t, messages, 1)
+	assert.Equal(t, "orders.eu", messages[0].RoutingKey)
+	assert.Equal(t, map[string]interface{}{"Tenant": "acme"}, messages[0].Headers)
+	assert.Equal(t, "order", messages[0].Type)
+	assert.Equal(t, uint8(2), messages[0].DeliveryMode)
+	assert.Equal(t, []byte(`{"id": 1}`), messages[0].Body)
+}
+
+func TestRecordMessageSourceFailsOnUnknownCSVColumn(t *testing.T) {
+	_, err := NewRecordMessageSource("csv", strings.NewReader("id\n1\n"), FieldMapping{"Body": "payload"})
+	assert.ErrorContains(t, err, `unknown column "payload"`)
+}
+
+func TestRecordMessageSourceFailsOnInvalidPropertyValue(t *testing.T) {
+	source, err := NewRecordMessageSource("csv", strings.NewReader("prio\nhigh\n"), FieldMapping{"Priority": "prio"})
+	require.NoError(t, err)
+
+	_, err = source()
+
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestRecordMessageSourceReadsJSONLinesAsBodyByDefault(t *testing.T) {
+	source, err := NewRecordMessageSource("jsonl-body", strings.NewReader("{\"id\": 1}\n\n{\"id\": 2}\n"), nil)
+	require.NoError(t, err)
+
+	messages := readAllMessages(t, source)
+
+	require.Len(t, messages, 2)
+	assert.Equal(t, []byte(`{"id": 1}`), messages[0].Body)
+	assert.Equal(t, []byte(`{"id": 2}`), messages[1].Body)
+}
+
+func TestRecordMessageSourceMapsJSONPaths(t *testing.T) {
+	doc := `{"meta": {"region": "eu", "tags": ["a", "b"], "retries": 3}, "order": {"id": 1.5}}`
+	mapping := FieldMapping{
+		"RoutingKey":     "meta.region",
+		"Header.tag":     "meta.tags.1",
+		"Header.retries": "meta.retries",
+		"MessageID":      "order.id",
+		"Body":           "order",
+	}
+	source, err := NewRecordMessageSource("jsonl-body", strings.NewReader(doc), mapping)
+	require.NoError(t, err)
+
+	messages := readAllMessages(t, source)
+
+	require.Len(t, messages, 1)
+	assert.Equal(t, "eu", messages[0].RoutingKey)
+	assert.Equal(t, map[string]interface{}{"tag": "b", "retries": int64(3)}, messages[0].Headers)
+	assert.Equal(t, "1.5", messages[0].MessageID)
+	assert.JSONEq(t, `{"id": 1.5}`, string(messages[0].Body))
+}
+
+func TestRecordMessageSourceFailsOnMissingJSONPath(t *testing.T) {
+	source, err := NewRecordMessageSource("jsonl-body", strings.NewReader(`{"a": 1}`), FieldMapping{"Body": "b"})
+	require.NoError(t, err)
+
+	_, err = source()
+
+	assert.ErrorContains(t, err, `line 1: map Body: path "b" not found`)
+}
+
+func TestRecordMessageSourceFailsOnInvalidJSON(t *testing.T) {
+	source, err := NewRecordMessageSource("jsonl-body", strings.NewReader(`{"a": `), nil)
+	require.NoError(t, err)
+
+	_, err = source()
+
+	assert.ErrorContains(t, err, "line 1")
+}
@@ -1,6 +1,110 @@
 package main
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
 // MessageSource provides messages that can be published.
 // returns the message to be published, xor an error. When no more
 // messages are available, io.EOF must be returned.
 type MessageSource func() (RabtapPersistentMessage, error)
+
+// MessageSourceFactory creates a MessageSource providing the messages from
+// the start, e.g. by re-opening a file.
+type MessageSourceFactory func() (MessageSource, error)
+
+// NewRepeatingMessageSource returns a MessageSource that provides the
+// messages of the given source and then of the sources created by reopen,
+// repeat times in total, or endlessly if repeat is 0. Repeating stops when
+// a round provides no messages.
+func NewRepeatingMessageSource(source MessageSource, reopen MessageSourceFactory, repeat int) MessageSource {
+	round, count := 1, 0
+	return func() (RabtapPersistentMessage, error) {
+		for {
+			msg, err := source()
+			if err == nil {
+				count++
+				return msg, nil
+			}
+			if !errors.Is(err, io.EOF) || count == 0 || (repeat != 0 && round >= repeat) {
+				return msg, err
+			}
+			next, err := reopen()
+			if err != nil {
+				return RabtapPersistentMessage{}, fmt.Errorf("reopen message source: %w", err)
+			}
+			source = next
+			round++
+			count = 0
+		}
+	}
+}
+
+// NewReplayableMessageSource returns a MessageSource providing the messages
+// of the given source, and a MessageSourceFactory creating sources that
+// replay the messages read so far from memory. Use it to repeat sources that
+// can not be read again, like stdin.
+func NewReplayableMessageSource(source MessageSource) (MessageSource, MessageSourceFactory) {
+	var messages []RabtapPersistentMessage
+	recording := func() (RabtapPersistentMessage, error) {
+		msg, err := source()
+		if err == nil {
+			messages = append(messages, msg)
+		}
+		return msg, err
+	}
+	replay := func() (MessageSource, error) {
+		next := 0
+		return func() (RabtapPersistentMessage, error) {
+			if next >= len(messages) {
+				return RabtapPersistentMessage{}, io.EOF
+			}
+			next++
+			return messages[next-1], nil
+		}, nil
+	}
+	return recording, replay
+}
+
+// NewClosingMessageSource returns a MessageSource that provides the messages
+// of the given source and closes closer, when the source returns an error,
+// e.g. io.EOF.
+func NewClosingMessageSource(source MessageSource, closer io.Closer) MessageSource {
+	closed := false
+	return func() (RabtapPersistentMessage, error) {
+		msg, err := source()
+		if err != nil && !closed {
+			closed = true
+			_ = closer.Close()
+		}
+		return msg, err
+	}
+}
+
+// NewFilteringMessageSource returns a MessageSource that provides only the
+// messages of the given source the predicate is true for. The predicate is
+// evaluated in the same environment as the filter of the subscribe command.
+// Messages the predicate fails to evaluate for are skipped.
+func NewFilteringMessageSource(source MessageSource, pred Predicate, logger *slog.Logger) MessageSource {
+	count := int64(0)
+	return func() (RabtapPersistentMessage, error) {
+		for {
+			msg, err := source()
+			if err != nil {
+				return msg, err
+			}
+			passed, err := pred.Eval(createMessagePredEnv(msg.ToTapMessage(), count))
+			if err != nil {
+				logger.Error("filter expression evaluation failed", "error", err)
+			}
+			if passed {
+				count++
+				return msg, nil
+			}
+			logger.Debug("message was filtered out", "message_id", msg.MessageID)
+		}
+	}
+}
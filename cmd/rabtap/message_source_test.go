@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSliceMessageSource(bodies ...string) MessageSource {
+	return func() (RabtapPersistentMessage, error) {
+		if len(bodies) == 0 {
+			return RabtapPersistentMessage{}, io.EOF
+		}
+		body := bodies[0]
+		bodies = bodies[1:]
+		return RabtapPersistentMessage{Body: []byte(body)}, nil
+	}
+}
+
+// readBodies reads up to max messages from the source and returns their bodies
+func readBodies(t *testing.T, source MessageSource, max int) []string {
+	bodies := []string{}
+	for range max {
+		msg, err := source()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		bodies = append(bodies, string(msg.Body))
+	}
+	return bodies
+}
+
+// newSliceMessageSourceFactory returns a MessageSourceFactory creating slice
+// message sources and counts the created sources in opened
+func newSliceMessageSourceFactory(opened *int, bodies ...string) MessageSourceFactory {
+	return func() (MessageSource, error) {
+		*opened++
+		return newSliceMessageSource(bodies...), nil
+	}
+}
+
+func TestRepeatingMessageSourceRepeatsMessagesGivenNumberOfTimes(t *testing.T) {
+	opened := 0
+	source := NewRepeatingMessageSource(newSliceMessageSource("a", "b"),
+		newSliceMessageSourceFactory(&opened, "a", "b"), 3)
+
+	assert.Equal(t, []string{"a", "b", "a", "b", "a", "b"}, readBodies(t, source, 100))
+	assert.Equal(t, 2, opened)
+}
+
+func TestRepeatingMessageSourceRepeatsMessagesEndlessly(t *testing.T) {
+	opened := 0
+	source := NewRepeatingMessageSource(newSliceMessageSource("a", "b"),
+		newSliceMessageSourceFactory(&opened, "a", "b"), 0)
+
+	assert.Equal(t, []string{"a", "b", "a", "b", "a"}, readBodies(t, source, 5))
+}
+
+func TestRepeatingMessageSourceEndsOnEmptySource(t *testing.T) {
+	opened := 0
+	source := NewRepeatingMessageSource(newSliceMessageSource(), newSliceMessageSourceFactory(&opened), 0)
+
+	_, err := source()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 0, opened)
+}
+
+func TestRepeatingMessageSourcePropagatesReadError(t *testing.T) {
+	opened := 0
+	source := NewRepeatingMessageSource(func() (RabtapPersistentMessage, error) {
+		return RabtapPersistentMessage{}, errors.New("error")
+	}, newSliceMessageSourceFactory(&opened), 2)
+
+	_, err := source()
+	assert.EqualError(t, err, "error")
+}
+
+func TestRepeatingMessageSourcePropagatesReopenError(t *testing.T) {
+	source := NewRepeatingMessageSource(newSliceMessageSource("a"), func() (MessageSource, error) {
+		return nil, errors.New("error")
+	}, 2)
+
+	readBodies(t, source, 1)
+	_, err := source()
+	assert.EqualError(t, err, "reopen message source: error")
+}
+
+func TestReplayableMessageSourceReplaysMessagesFromMemory(t *testing.T) {
+	source, replay := NewReplayableMessageSource(newSliceMessageSource("a", "b"))
+	source = NewRepeatingMessageSource(source, replay, 3)
+
+	assert.Equal(t, []string{"a", "b", "a", "b", "a", "b"}, readBodies(t, source, 100))
+}
+
+type closeRecorder struct{ closed int }
+
+func (s *closeRecorder) Close() error {
+	s.closed++
+	return nil
+}
+
+func TestClosingMessageSourceClosesOnceAfterLastMessage(t *testing.T) {
+	closer := &closeRecorder{}
+	source := NewClosingMessageSource(newSliceMessageSource("a"), closer)
+
+	readBodies(t, source, 1)
+	assert.Equal(t, 0, closer.closed)
+	_, err := source()
+	assert.Equal(t, io.EOF, err)
+	_, _ = source()
+	assert.Equal(t, 1, closer.closed)
+}
+
+func TestFilteringMessageSourceSkipsMessagesNotMatchingThePredicate(t *testing.T) {
+	pred, err := NewExprPredicate(`r.toStr(r.msg.Body) startsWith "a" && r.count < 2`)
+	require.NoError(t, err)
+	logger := slog.New(slog.DiscardHandler)
+	source := NewFilteringMessageSource(newSliceMessageSource("a1", "b", "a2", "a3"), pred, logger)
+
+	assert.Equal(t, []string{"a1", "a2"}, readBodies(t, source, 100))
+}
+
+func TestFilteringMessageSourceSkipsMessagesFailingToEvaluate(t *testing.T) {
+	pred, err := NewExprPredicate(`fromJSON(r.toStr(r.msg.Body)).ok`)
+	require.NoError(t, err)
+	logger := slog.New(slog.DiscardHandler)
+	source := NewFilteringMessageSource(newSliceMessageSource("invalid", `{"ok": true}`), pred, logger)
+
+	assert.Equal(t, []string{`{"ok": true}`}, readBodies(t, source, 100))
+}
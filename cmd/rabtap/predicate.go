@@ -6,3 +6,16 @@ package main
 type Predicate interface {
 	Eval(map[string]interface{}) (bool, error)
 }
+
+// AnyPredicate is true, if any of its predicates is true
+type AnyPredicate []Predicate
+
+func (s AnyPredicate) Eval(env map[string]interface{}) (bool, error) {
+	for _, pred := range s {
+		res, err := pred.Eval(env)
+		if err != nil || res {
+			return res, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnyPredicateIsTrueIfAnyPredicateIsTrue(t *testing.T) {
+	env := map[string]interface{}{}
+
+	res, err := AnyPredicate{constantPred{false}, constantPred{true}}.Eval(env)
+	assert.NoError(t, err)
+	assert.True(t, res)
+
+	res, err = AnyPredicate{constantPred{false}, constantPred{false}}.Eval(env)
+	assert.NoError(t, err)
+	assert.False(t, res)
+
+	res, err = AnyPredicate{}.Eval(env)
+	assert.NoError(t, err)
+	assert.False(t, res)
+}
+
+func TestAnyPredicateReturnsErrors(t *testing.T) {
+	failing := funcPred{func(map[string]interface{}) (bool, error) { return false, errors.New("failed") }}
+
+	_, err := AnyPredicate{failing, constantPred{true}}.Eval(map[string]interface{}{})
+
+	assert.ErrorContains(t, err, "failed")
+}
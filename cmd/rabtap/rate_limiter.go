@@ -0,0 +1,58 @@
+// Copyright (C) 2026 Jan Delgado
+
+package main
+
+import (
+	"time"
+)
+
+// TokenBucket limits the rate of events to a given number of events per
+// second, allowing bursts of up to burst events.
+type TokenBucket struct {
+	rate   float64 // tokens added per second
+	burst  float64 // max number of tokens
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewTokenBucket returns a TokenBucket allowing rate events per second. The
+// bucket is initially full.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+func (s *TokenBucket) refill() {
+	now := s.now()
+	s.tokens = min(s.burst, s.tokens+now.Sub(s.last).Seconds()*s.rate)
+	s.last = now
+}
+
+// Allow takes a token from the bucket and returns true, or returns false if
+// the bucket is empty, i.e. the rate is exceeded.
+func (s *TokenBucket) Allow() bool {
+	s.refill()
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// Take takes a token from the bucket and returns the time to wait until the
+// event conforms to the rate. Unlike Allow, the bucket can be overdrawn, so
+// consecutive calls return increasing waiting times.
+func (s *TokenBucket) Take() time.Duration {
+	s.refill()
+	s.tokens--
+	if s.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-s.tokens / s.rate * float64(time.Second))
+}
@@ -0,0 +1,45 @@
+// Copyright (C) 2026 Jan Delgado
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucketAllowsBurstAndRefillsWithRate(t *testing.T) {
+	now := time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+	bucket := NewTokenBucket(10, 2)
+	bucket.last = now
+	bucket.now = func() time.Time { return now }
+
+	assert.True(t, bucket.Allow())
+	assert.True(t, bucket.Allow())
+	assert.False(t, bucket.Allow())
+
+	now = now.Add(100 * time.Millisecond)
+	assert.True(t, bucket.Allow())
+	assert.False(t, bucket.Allow())
+
+	// tokens are not accumulated beyond the burst size
+	now = now.Add(time.Hour)
+	assert.True(t, bucket.Allow())
+	assert.True(t, bucket.Allow())
+	assert.False(t, bucket.Allow())
+}
+
+func TestTokenBucketTakeReturnsTimeToWaitForToken(t *testing.T) {
+	now := time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+	bucket := NewTokenBucket(10, 1)
+	bucket.last = now
+	bucket.now = func() time.Time { return now }
+
+	assert.Equal(t, time.Duration(0), bucket.Take())
+	assert.Equal(t, 100*time.Millisecond, bucket.Take())
+	assert.Equal(t, 200*time.Millisecond, bucket.Take())
+
+	now = now.Add(time.Second)
+	assert.Equal(t, time.Duration(0), bucket.Take())
+}
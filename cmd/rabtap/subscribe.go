@@ -10,6 +10,7 @@ import (
 	"io"
 	"log/slog"
 	"path"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -40,10 +41,20 @@ type MessageSink func(rabtap.TapMessage) error
 // var ErrMessageLoopEnded = errors.New("message loop ended")
 
 func createMessagePredEnv(msg rabtap.TapMessage, count int64) map[string]interface{} {
+	var source rabtap.TapSource // empty if not received by a tap
+	if msg.Source != nil {
+		source = *msg.Source
+	}
+	var death []rabtap.Death // empty if never dead-lettered
+	if msg.AmqpMessage != nil {
+		death = rabtap.DeathHistory(msg.AmqpMessage.Headers)
+	}
 	return map[string]interface{}{
-		"msg":   msg.AmqpMessage,
-		"count": count,
-		"toStr": func(b []byte) string { return string(b) },
+		"msg":    msg.AmqpMessage,
+		"source": source,
+		"death":  death,
+		"count":  count,
+		"toStr":  func(b []byte) string { return string(b) },
 		"gunzip": func(b []byte) ([]byte, error) {
 			return decompressGunzip(bytes.NewReader(b))
 		},
@@ -74,6 +85,48 @@ func NewLoopCountPred(limit int64) (*LoopCountPred, error) {
 	return &LoopCountPred{limit}, nil
 }
 
+// ReceivedCountPred is a message loop termination predicate, which terminates
+// the loop after the given number of messages were received, including the
+// messages not passing the filter. Expects a variable "received" in the
+// context.
+type ReceivedCountPred struct {
+	limit int64
+}
+
+func (s *ReceivedCountPred) Eval(env map[string]interface{}) (bool, error) {
+	received, ok := env["received"].(int64)
+	if !ok {
+		return false, fmt.Errorf("expected variable received of type int64, got %T", env["received"])
+	}
+	return received >= s.limit, nil
+}
+
+// AckMode controls when received messages are acknowledged
+type AckMode int
+
+const (
+	// AckOnReceive acknowledges messages on receipt
+	AckOnReceive AckMode = iota
+	// AckOnProcessed acknowledges messages after they were processed by the
+	// message sink. On errors of the message sink, the message is requeued.
+	AckOnProcessed
+	// AckOnFiltered works like AckOnProcessed, but only acknowledges messages
+	// passing the filter. Other messages are kept unacknowledged, and thus
+	// requeued when the subscription ends.
+	AckOnFiltered
+	// AckNever never acknowledges messages, which are all requeued when the
+	// subscription ends (i.e. browse the queue)
+	AckNever
+)
+
+// KeepsMessagesUnacknowledged returns true if messages are kept
+// unacknowledged until the subscription ends. Such messages must not be
+// acknowledged with the multiple flag and, when prefetching is limited, stop
+// the delivery of further messages once they fill the prefetch window.
+func (s AckMode) KeepsMessagesUnacknowledged() bool {
+	return s == AckOnFiltered || s == AckNever
+}
+
 // CreateAcknowledgeFunc returns the function used to acknowledge received
 // functions, wich will either be ACKed or REJECTED with optional REQUEUE
 // flag set.
@@ -92,10 +145,101 @@ func CreateAcknowledgeFunc(reject, requeue bool) AcknowledgeFunc {
 	}
 }
 
+// BatchAcknowledger acknowledges (or rejects) received messages in batches
+// using the multiple flag: the last message of a batch is acknowledged, which
+// includes all prior messages received on the channel. A batch is completed
+// after the given number of messages or after the given interval, whichever
+// comes first. Pending messages must be flushed on shutdown.
+type BatchAcknowledger struct {
+	mu       sync.Mutex
+	reject   bool
+	requeue  bool
+	size     int
+	interval time.Duration
+	last     *rabtap.TapMessage // last message not yet acknowledged
+	count    int                // number of messages not yet acknowledged
+	timer    *time.Timer
+	logger   *slog.Logger
+}
+
+// NewBatchAcknowledger returns a new BatchAcknowledger, which ACKs or REJECTs
+// with optional REQUEUE flag set, batches of size messages, at least every
+// interval.
+func NewBatchAcknowledger(reject, requeue bool, size int, interval time.Duration, logger *slog.Logger) *BatchAcknowledger {
+	return &BatchAcknowledger{
+		reject:   reject,
+		requeue:  requeue,
+		size:     size,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Acknowledge adds the message to the current batch, which is acknowledged
+// when complete. Use as AcknowledgeFunc.
+func (s *BatchAcknowledger) Acknowledge(message rabtap.TapMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// delivery tags start again after a reconnect, the prior batch belongs
+	// to the old channel
+	if s.last != nil && message.AmqpMessage.DeliveryTag <= s.last.AmqpMessage.DeliveryTag {
+		if err := s.flush(); err != nil {
+			s.logger.Error("acknowledge pending messages failed", "error", err)
+		}
+	}
+	s.last = &message
+	s.count++
+	if s.count >= s.size {
+		return s.flush()
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.interval, func() {
+			if err := s.Flush(); err != nil {
+				s.logger.Error("acknowledge pending messages failed", "error", err)
+			}
+		})
+	}
+	return nil
+}
+
+// Flush acknowledges all pending messages
+func (s *BatchAcknowledger) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flush()
+}
+
+func (s *BatchAcknowledger) flush() error {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.last == nil {
+		return nil
+	}
+	last, count := s.last, s.count
+	s.last, s.count = nil, 0
+	s.logger.Debug("acknowledging batch", "messages", count, "reject", s.reject)
+	if s.reject {
+		if err := last.AmqpMessage.Nack(true, s.requeue); err != nil {
+			return fmt.Errorf("REJECT of %d messages failed: %w", count, err)
+		}
+		return nil
+	}
+	if err := last.AmqpMessage.Ack(true); err != nil {
+		return fmt.Errorf("ACK of %d messages failed: %w", count, err)
+	}
+	return nil
+}
+
 // MessageReceiveLoop passes received AMQP messages to the messageSink and
 // handles errors received on the errorChan. AMQP messages are ascknowledged by
-// the provides acknowleder function. Each message is passed to the predicate
-// termPred function. If true is returned, processing is ended. Timeout
+// the provides acknowleder function, at the point in time controlled by the
+// ackMode. If the sink fails in the AckOnProcessed and AckOnFiltered modes,
+// the message is requeued and processing is ended. After each message, the
+// predicate termPred function is evaluated. If true is returned, processing
+// is ended. Timeout
 // specifies an idle timeout, which will end processing when for the given
 // duration no new messages are received on messageChan.
 // TODO pass in struct, limit number of arguments
@@ -106,13 +250,15 @@ func MessageReceiveLoop(ctx context.Context,
 	filterPred Predicate,
 	termPred Predicate,
 	acknowledger AcknowledgeFunc,
+	ackMode AckMode,
 	timeout time.Duration,
 	logger *slog.Logger,
 ) error {
 	timeoutTicker := time.NewTicker(timeout)
 	defer timeoutTicker.Stop()
 
-	count := int64(0) // counts not filtered messages
+	count := int64(0)    // counts not filtered messages
+	received := int64(0) // counts all messages
 	for {
 		select {
 
@@ -133,28 +279,45 @@ func MessageReceiveLoop(ctx context.Context,
 			}
 			logger.Debug("new message", "message", message)
 
-			// acknowledge or reject the message
-			if err := acknowledger(message); err != nil {
-				logger.Error("acknowledge failed", "error", err)
+			acknowledge := func() {
+				// acknowledge or reject the message
+				if err := acknowledger(message); err != nil {
+					logger.Error("acknowledge failed", "error", err)
+				}
+			}
+			if ackMode == AckOnReceive {
+				acknowledge()
 			}
 
+			received += 1
 			env := createMessagePredEnv(message, count)
 			passed, err := filterPred.Eval(env)
 			if err != nil {
 				logger.Error("filter expression evaluation failed", "error", err)
 			}
 
-			if !passed {
+			if passed {
+				count += 1
+				if err := messageSink(message); err != nil {
+					logger.Error("message sink error", "error", err)
+					if ackMode == AckOnProcessed || ackMode == AckOnFiltered {
+						if err := message.AmqpMessage.Nack(false, true); err != nil {
+							logger.Error("requeue failed", "error", err)
+						}
+						return fmt.Errorf("message sink: %w", err)
+					}
+				} else if ackMode == AckOnProcessed || ackMode == AckOnFiltered {
+					acknowledge()
+				}
+			} else {
 				logger.Debug("message was filtered out", "message_id", message.AmqpMessage.MessageId)
-				continue
-			}
-			count += 1
-
-			if err := messageSink(message); err != nil {
-				logger.Error("message sink error", "error", err)
+				if ackMode == AckOnProcessed {
+					acknowledge()
+				}
 			}
 
 			env = createMessagePredEnv(message, count)
+			env["received"] = received
 			terminate, err := termPred.Eval(env)
 			if err != nil {
 				logger.Error("terminate expression evaluation failed", "error", err)
@@ -14,6 +14,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -55,6 +56,37 @@ func (s MockAcknowledger) Reject(tag uint64, requeue bool) error {
 	return nil
 }
 
+// a mocked amqp.Acknowledger recording all calls
+type recordingAcknowledger struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (s *recordingAcknowledger) record(format string, args ...interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, fmt.Sprintf(format, args...))
+	return nil
+}
+
+func (s *recordingAcknowledger) recorded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.calls...)
+}
+
+func (s *recordingAcknowledger) Ack(tag uint64, multiple bool) error {
+	return s.record("ack %d multiple=%t", tag, multiple)
+}
+
+func (s *recordingAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	return s.record("nack %d multiple=%t requeue=%t", tag, multiple, requeue)
+}
+
+func (s *recordingAcknowledger) Reject(tag uint64, requeue bool) error {
+	return s.record("reject %d requeue=%t", tag, requeue)
+}
+
 func TestCreateMessagePredicateProvidesMessageContext(t *testing.T) {
 	// when we evalute the predicate for the test Messages
 	msg := rabtap.TapMessage{AmqpMessage: &amqp.Delivery{MessageId: "match123"}}
@@ -66,6 +98,47 @@ func TestCreateMessagePredicateProvidesMessageContext(t *testing.T) {
 	assert.Contains(t, env, "toStr")
 }
 
+func TestCreateMessagePredicateProvidesSourceOfTappedMessage(t *testing.T) {
+	msg := rabtap.TapMessage{
+		AmqpMessage: &amqp.Delivery{},
+		Source:      &rabtap.TapSource{Exchange: "amq.topic", BindingKey: "#"},
+	}
+	pred, err := NewExprPredicate("r.source.Exchange == 'amq.topic' && r.source.BindingKey == '#'")
+	require.NoError(t, err)
+
+	passed, err := pred.Eval(createMessagePredEnv(msg, 1))
+	require.NoError(t, err)
+	assert.True(t, passed)
+
+	// messages not received by a tap have an empty source
+	msg.Source = nil
+	passed, err = pred.Eval(createMessagePredEnv(msg, 1))
+	require.NoError(t, err)
+	assert.False(t, passed)
+}
+
+func TestCreateMessagePredicateProvidesDeathHistoryOfMessage(t *testing.T) {
+	msg := rabtap.TapMessage{
+		AmqpMessage: &amqp.Delivery{Headers: amqp.Table{
+			"x-death": []interface{}{
+				amqp.Table{"queue": "orders", "reason": "expired", "count": int64(3)},
+			},
+		}},
+	}
+	pred, err := NewExprPredicate("len(r.death) > 0 && r.death[0].reason == 'expired' && r.death[0].count == 3")
+	require.NoError(t, err)
+
+	passed, err := pred.Eval(createMessagePredEnv(msg, 1))
+	require.NoError(t, err)
+	assert.True(t, passed)
+
+	// messages never dead-lettered have an empty history
+	msg.AmqpMessage.Headers = nil
+	passed, err = pred.Eval(createMessagePredEnv(msg, 1))
+	require.NoError(t, err)
+	assert.False(t, passed)
+}
+
 func TestCreateAcknowledgeFuncReturnedFuncCorreclyAcknowledgesTheMessage(t *testing.T) {
 	testcases := []struct {
 		reject, requeue               bool // given
@@ -125,6 +198,82 @@ func TestCreateCountingMessageReceivePredReturnsTrueOnWhenLimitIsReached(t *test
 	}
 }
 
+func TestReceivedCountPredReturnsTrueWhenLimitIsReached(t *testing.T) {
+	pred := &ReceivedCountPred{3}
+
+	res, err := pred.Eval(map[string]interface{}{"received": int64(2)})
+	require.NoError(t, err)
+	assert.False(t, res)
+
+	res, err = pred.Eval(map[string]interface{}{"received": int64(3)})
+	require.NoError(t, err)
+	assert.True(t, res)
+}
+
+func TestReceivedCountPredFailsWithoutReceivedVariable(t *testing.T) {
+	_, err := (&ReceivedCountPred{3}).Eval(map[string]interface{}{"count": int64(3)})
+
+	assert.Error(t, err)
+}
+
+func TestBatchAcknowledgerAcknowledgesCompleteBatches(t *testing.T) {
+	mock := &recordingAcknowledger{}
+	acknowledger := NewBatchAcknowledger(false, false, 3, time.Hour, slog.New(slog.DiscardHandler))
+
+	for tag := uint64(1); tag <= 7; tag++ {
+		err := acknowledger.Acknowledge(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{Acknowledger: mock, DeliveryTag: tag}})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"ack 3 multiple=true", "ack 6 multiple=true"}, mock.recorded())
+
+	require.NoError(t, acknowledger.Flush())
+	assert.Equal(t, []string{"ack 3 multiple=true", "ack 6 multiple=true", "ack 7 multiple=true"}, mock.recorded())
+
+	// nothing pending
+	require.NoError(t, acknowledger.Flush())
+	assert.Len(t, mock.recorded(), 3)
+}
+
+func TestBatchAcknowledgerRejectsBatches(t *testing.T) {
+	mock := &recordingAcknowledger{}
+	acknowledger := NewBatchAcknowledger(true, true, 2, time.Hour, slog.New(slog.DiscardHandler))
+
+	for tag := uint64(1); tag <= 2; tag++ {
+		err := acknowledger.Acknowledge(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{Acknowledger: mock, DeliveryTag: tag}})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"nack 2 multiple=true requeue=true"}, mock.recorded())
+}
+
+func TestBatchAcknowledgerAcknowledgesIncompleteBatchAfterInterval(t *testing.T) {
+	mock := &recordingAcknowledger{}
+	acknowledger := NewBatchAcknowledger(false, false, 100, 10*time.Millisecond, slog.New(slog.DiscardHandler))
+
+	err := acknowledger.Acknowledge(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{Acknowledger: mock, DeliveryTag: 1}})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"ack 1 multiple=true"}, mock.recorded())
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestBatchAcknowledgerFlushesBatchOfPriorChannel(t *testing.T) {
+	oldChannel, newChannel := &recordingAcknowledger{}, &recordingAcknowledger{}
+	acknowledger := NewBatchAcknowledger(false, false, 100, time.Hour, slog.New(slog.DiscardHandler))
+
+	for _, m := range []*amqp.Delivery{
+		{Acknowledger: oldChannel, DeliveryTag: 1},
+		{Acknowledger: oldChannel, DeliveryTag: 2},
+		{Acknowledger: newChannel, DeliveryTag: 1}, // after reconnect
+	} {
+		require.NoError(t, acknowledger.Acknowledge(rabtap.TapMessage{AmqpMessage: m}))
+	}
+	require.NoError(t, acknowledger.Flush())
+
+	assert.Equal(t, []string{"ack 2 multiple=true"}, oldChannel.recorded())
+	assert.Equal(t, []string{"ack 1 multiple=true"}, newChannel.recorded())
+}
+
 func TestChainMessageSinkCallsBothFunctions(t *testing.T) {
 	firstCalled := false
 	secondCalled := false
@@ -285,7 +434,7 @@ func TestMessageReceiveLoopForwardsMessagesOnChannel(t *testing.T) {
 	passPred := constantPred{val: true}
 	acknowledger := func(rabtap.TapMessage) error { return nil }
 	go func() {
-		_ = MessageReceiveLoop(ctx, messageChan, errorChan, sink, passPred, termPred, acknowledger, time.Second*10, logger)
+		_ = MessageReceiveLoop(ctx, messageChan, errorChan, sink, passPred, termPred, acknowledger, AckOnReceive, time.Second*10, logger)
 	}()
 
 	messageChan <- rabtap.TapMessage{}
@@ -304,7 +453,7 @@ func TestMessageReceiveLoopExitsOnChannelClose(t *testing.T) {
 
 	close(messageChan)
 	acknowledger := func(rabtap.TapMessage) error { return nil }
-	err := MessageReceiveLoop(ctx, messageChan, errorChan, nopMessageSink, passPred, termPred, acknowledger, time.Second*10, logger)
+	err := MessageReceiveLoop(ctx, messageChan, errorChan, nopMessageSink, passPred, termPred, acknowledger, AckOnReceive, time.Second*10, logger)
 
 	assert.Nil(t, err)
 }
@@ -319,11 +468,80 @@ func TestMessageReceiveLoopExitsWhenTermPredReturnsTrue(t *testing.T) {
 
 	messageChan <- rabtap.TapMessage{}
 	acknowledger := func(rabtap.TapMessage) error { return nil }
-	err := MessageReceiveLoop(ctx, messageChan, errorChan, nopMessageSink, passPred, termPred, acknowledger, time.Second*10, logger)
+	err := MessageReceiveLoop(ctx, messageChan, errorChan, nopMessageSink, passPred, termPred, acknowledger, AckOnReceive, time.Second*10, logger)
 
 	assert.Nil(t, err)
 }
 
+func TestMessageReceiveLoopAcknowledgesMessagesAccordingToAckMode(t *testing.T) {
+	testcases := []struct {
+		mode     AckMode
+		acked    []string // expected
+		requeued []string // expected
+		err      bool     // expected
+	}{
+		{AckOnReceive, []string{"pass", "drop", "fail", "after"}, nil, false},
+		{AckOnProcessed, []string{"pass", "drop"}, []string{"fail"}, true},
+		{AckOnFiltered, []string{"pass"}, []string{"fail"}, true},
+		{AckNever, nil, nil, false},
+	}
+	for _, tc := range testcases {
+		t.Run(fmt.Sprintf("mode=%d", tc.mode), func(t *testing.T) {
+			filterPred, err := NewExprPredicate("r.msg.MessageId != 'drop'")
+			require.NoError(t, err)
+			sink := func(message rabtap.TapMessage) error {
+				if message.AmqpMessage.MessageId == "fail" {
+					return errors.New("disk full")
+				}
+				return nil
+			}
+			var acked []string
+			acknowledger := func(message rabtap.TapMessage) error {
+				acked = append(acked, message.AmqpMessage.MessageId)
+				return nil
+			}
+			mock := &recordingAcknowledger{}
+			messageChan := make(rabtap.TapChannel, 4)
+			for _, id := range []string{"pass", "drop", "fail", "after"} {
+				messageChan <- rabtap.TapMessage{AmqpMessage: &amqp.Delivery{MessageId: id, Acknowledger: mock}}
+			}
+			close(messageChan)
+
+			err = MessageReceiveLoop(context.Background(), messageChan, make(rabtap.SubscribeErrorChannel),
+				sink, filterPred, constantPred{val: false}, acknowledger, tc.mode, time.Second*10,
+				slog.New(slog.DiscardHandler))
+
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.acked, acked)
+			assert.Equal(t, len(tc.requeued), len(mock.recorded()))
+			for _, call := range mock.recorded() {
+				assert.Equal(t, "nack 0 multiple=false requeue=true", call)
+			}
+		})
+	}
+}
+
+func TestMessageReceiveLoopTerminatesWhenAllMessagesWereReceived(t *testing.T) {
+	messageChan := make(rabtap.TapChannel, 4)
+	for _, id := range []string{"pass", "drop", "pass", "drop"} {
+		messageChan <- rabtap.TapMessage{AmqpMessage: &amqp.Delivery{MessageId: id}}
+	}
+	filterPred, err := NewExprPredicate("r.msg.MessageId == 'pass'")
+	require.NoError(t, err)
+	received := 0
+	sink := func(rabtap.TapMessage) error { received++; return nil }
+	acknowledger := func(rabtap.TapMessage) error { return nil }
+
+	// the last message received does not pass the filter
+	err = MessageReceiveLoop(context.Background(), messageChan, make(rabtap.SubscribeErrorChannel),
+		sink, filterPred, &ReceivedCountPred{3}, acknowledger, AckOnFiltered, time.Second*10,
+		slog.New(slog.DiscardHandler))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, received)
+	assert.Len(t, messageChan, 1)
+}
+
 func TestMessageReceiveLoopIgnoresFilteredMessages(t *testing.T) {
 	logger := slog.New(slog.DiscardHandler)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -351,7 +569,7 @@ func TestMessageReceiveLoopIgnoresFilteredMessages(t *testing.T) {
 	messageChan <- rabtap.TapMessage{AmqpMessage: &amqp.Delivery{MessageId: ""}}
 
 	_ = MessageReceiveLoop(ctx, messageChan, errorChan, sink,
-		filterPred, termPred, acknowledger, time.Second*1, logger)
+		filterPred, termPred, acknowledger, AckOnReceive, time.Second*1, logger)
 
 	// we expect 2 of them to be filtered out
 	cancel()
@@ -369,7 +587,7 @@ func TestMessageReceiveLoopExitsWithErrorWhenIdle(t *testing.T) {
 	acknowledger := func(rabtap.TapMessage) error { return nil }
 
 	// when
-	err := MessageReceiveLoop(ctx, messageChan, errorChan, nopMessageSink, passPred, termPred, acknowledger, time.Second*1, logger)
+	err := MessageReceiveLoop(ctx, messageChan, errorChan, nopMessageSink, passPred, termPred, acknowledger, AckOnReceive, time.Second*1, logger)
 
 	// Then
 	assert.Equal(t, ErrIdleTimeout, err)
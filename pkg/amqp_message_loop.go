@@ -27,26 +27,34 @@ func amqpMessageLoop(
 				return doReconnect, fmt.Errorf("no more messages")
 			}
 
+			var tapMessage TapMessage
 			switch msg := message.(type) {
 
 			case *amqp.Error:
 				// TODO ctx?
 				errOutCh <- &SubscribeError{Reason: SubscribeErrorChannelError, Cause: msg}
+				continue
 
 			case amqp.Delivery:
-				received := time.Now()
-				// Avoid blocking write to out when e.g. on the other end of the
-				// channel the user pressed Ctrl+S to stop console output
-				// TODO ctx.Done really needed?
-				select {
-				case <-ctx.Done():
-					return doNotReconnect, nil
-				case outCh <- NewTapMessage(&msg, received):
-				}
+				tapMessage = NewTapMessage(&msg, time.Now())
+
+			case sourcedDelivery:
+				tapMessage = NewTapMessage(&msg.delivery, time.Now())
+				tapMessage.Source = msg.source
+
 			default:
 				panic("unknown message type")
 			}
 
+			// Avoid blocking write to out when e.g. on the other end of the
+			// channel the user pressed Ctrl+S to stop console output
+			// TODO ctx.Done really needed?
+			select {
+			case <-ctx.Done():
+				return doNotReconnect, nil
+			case outCh <- tapMessage:
+			}
+
 		case <-ctx.Done():
 			return doNotReconnect, nil
 		}
@@ -0,0 +1,113 @@
+// decode the dead-letter history of messages
+// (see https://www.rabbitmq.com/docs/dlx)
+// Copyright (C) 2026 Jan Delgado
+
+package rabtap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Death is an entry of the x-death header, which is added or updated by the
+// broker each time a message is dead-lettered. The expr tags name the fields
+// in filter expressions.
+type Death struct {
+	Queue       string    `expr:"queue"`       // queue the message was dead-lettered from
+	Reason      string    `expr:"reason"`      // rejected, expired, maxlen or delivery_limit
+	Count       int64     `expr:"count"`       // number of times dead-lettered from queue for reason
+	Exchange    string    `expr:"exchange"`    // exchange the message was published to
+	RoutingKeys []string  `expr:"routingKeys"` // routing keys the message was published with
+	Time        time.Time `expr:"time"`        // time of the first dead-lettering
+}
+
+func (s Death) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s from queue %s", s.Reason, s.Queue)
+	if s.Exchange != "" {
+		fmt.Fprintf(&b, ", exchange %s", s.Exchange)
+	}
+	if len(s.RoutingKeys) > 0 {
+		fmt.Fprintf(&b, ", routing keys %s", strings.Join(s.RoutingKeys, ","))
+	}
+	if s.Count > 0 {
+		fmt.Fprintf(&b, ", count %d", s.Count)
+	}
+	if !s.Time.IsZero() {
+		fmt.Fprintf(&b, ", time %s", s.Time.Format(time.RFC3339))
+	}
+	return b.String()
+}
+
+// DeathHistory decodes the x-death header of a message. The most recent
+// dead-lettering comes first. Returns nil if the message was never
+// dead-lettered.
+func DeathHistory(headers amqp.Table) []Death {
+	entries, _ := headers["x-death"].([]interface{})
+	var deaths []Death
+	for _, entry := range entries {
+		t, ok := entry.(amqp.Table)
+		if !ok {
+			continue
+		}
+		deaths = append(deaths, Death{
+			Queue:       tableString(t, "queue"),
+			Reason:      tableString(t, "reason"),
+			Count:       tableInt(t["count"]),
+			Exchange:    tableString(t, "exchange"),
+			RoutingKeys: tableStrings(t, "routing-keys"),
+			Time:        tableTimestamp(t, "time"),
+		})
+	}
+	return deaths
+}
+
+// FirstDeath decodes the x-first-death-* headers of a message, describing
+// the first time the message was dead-lettered. Only Queue, Reason and
+// Exchange are set. Returns nil if the headers are not present.
+func FirstDeath(headers amqp.Table) *Death {
+	if _, found := headers["x-first-death-queue"]; !found {
+		return nil
+	}
+	return &Death{
+		Queue:    tableString(headers, "x-first-death-queue"),
+		Reason:   tableString(headers, "x-first-death-reason"),
+		Exchange: tableString(headers, "x-first-death-exchange"),
+	}
+}
+
+// IsDeathHeader returns true if the given header is set by the broker when
+// a message is dead-lettered
+func IsDeathHeader(key string) bool {
+	return key == "x-death" ||
+		strings.HasPrefix(key, "x-first-death-") ||
+		strings.HasPrefix(key, "x-last-death-")
+}
+
+// DeathOrigin returns the exchange and routing key a dead-lettered message
+// was originally published to, using the x-first-death-* headers and the
+// x-death history. Returns false if the message was never dead-lettered.
+func DeathOrigin(headers amqp.Table) (exchange, routingKey string, ok bool) {
+	deaths := DeathHistory(headers)
+	if len(deaths) == 0 {
+		return "", "", false
+	}
+	// the oldest entry comes last, unless the first death is found
+	origin := deaths[len(deaths)-1]
+	if first := FirstDeath(headers); first != nil {
+		for _, death := range deaths {
+			if death.Queue == first.Queue && death.Reason == first.Reason {
+				origin = death
+				break
+			}
+		}
+		origin.Exchange = first.Exchange
+	}
+	if len(origin.RoutingKeys) > 0 {
+		routingKey = origin.RoutingKeys[0]
+	}
+	return origin.Exchange, routingKey, true
+}
@@ -0,0 +1,102 @@
+package rabtap
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var deathTime = time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+
+// headers of a message that expired in queue "orders-delay" and then was
+// rejected from queue "orders"
+func deadLetteredHeaders() amqp.Table {
+	return amqp.Table{
+		"x-death": []interface{}{
+			amqp.Table{
+				"queue":        "orders",
+				"reason":       "rejected",
+				"count":        int64(2),
+				"exchange":     "dlx",
+				"routing-keys": []interface{}{"order.retry"},
+				"time":         deathTime.Add(time.Minute),
+			},
+			amqp.Table{
+				"queue":        "orders-delay",
+				"reason":       "expired",
+				"count":        int64(1),
+				"exchange":     "orders",
+				"routing-keys": []interface{}{"order.new", "order.cc"},
+				"time":         deathTime,
+			},
+		},
+		"x-first-death-queue":    "orders-delay",
+		"x-first-death-reason":   "expired",
+		"x-first-death-exchange": "orders",
+		"app":                    "value",
+	}
+}
+
+func TestDeathHistoryDecodesXDeathHeader(t *testing.T) {
+	deaths := DeathHistory(deadLetteredHeaders())
+
+	assert.Equal(t, []Death{
+		{Queue: "orders", Reason: "rejected", Count: 2, Exchange: "dlx",
+			RoutingKeys: []string{"order.retry"}, Time: deathTime.Add(time.Minute)},
+		{Queue: "orders-delay", Reason: "expired", Count: 1, Exchange: "orders",
+			RoutingKeys: []string{"order.new", "order.cc"}, Time: deathTime},
+	}, deaths)
+}
+
+func TestDeathHistoryIsEmptyIfMessageWasNotDeadLettered(t *testing.T) {
+	assert.Empty(t, DeathHistory(amqp.Table{}))
+	assert.Empty(t, DeathHistory(nil))
+	assert.Nil(t, FirstDeath(amqp.Table{}))
+}
+
+func TestFirstDeathDecodesXFirstDeathHeaders(t *testing.T) {
+	assert.Equal(t, &Death{Queue: "orders-delay", Reason: "expired", Exchange: "orders"},
+		FirstDeath(deadLetteredHeaders()))
+}
+
+func TestDeathStringIsReadable(t *testing.T) {
+	deaths := DeathHistory(deadLetteredHeaders())
+
+	assert.Equal(t, "expired from queue orders-delay, exchange orders, routing keys order.new,order.cc, count 1, time 2026-10-16T12:00:00Z",
+		deaths[1].String())
+	assert.Equal(t, "expired from queue orders-delay, exchange orders",
+		FirstDeath(deadLetteredHeaders()).String())
+}
+
+func TestIsDeathHeader(t *testing.T) {
+	assert.True(t, IsDeathHeader("x-death"))
+	assert.True(t, IsDeathHeader("x-first-death-queue"))
+	assert.True(t, IsDeathHeader("x-last-death-reason"))
+	assert.False(t, IsDeathHeader("x-match"))
+}
+
+func TestDeathOriginUsesFirstDeath(t *testing.T) {
+	exchange, key, ok := DeathOrigin(deadLetteredHeaders())
+
+	assert.True(t, ok)
+	assert.Equal(t, "orders", exchange)
+	assert.Equal(t, "order.new", key)
+}
+
+func TestDeathOriginUsesOldestDeathWithoutFirstDeathHeaders(t *testing.T) {
+	headers := deadLetteredHeaders()
+	delete(headers, "x-first-death-queue")
+
+	exchange, key, ok := DeathOrigin(headers)
+
+	assert.True(t, ok)
+	assert.Equal(t, "orders", exchange)
+	assert.Equal(t, "order.new", key)
+}
+
+func TestDeathOriginFailsIfMessageWasNotDeadLettered(t *testing.T) {
+	_, _, ok := DeathOrigin(amqp.Table{})
+	assert.False(t, ok)
+}
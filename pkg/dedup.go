@@ -0,0 +1,123 @@
+// Copyright (C) 2026 Jan Delgado
+// Suppression of duplicate messages received through overlapping taps
+
+package rabtap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// MessageKey returns the key identifying duplicates of the given message. If
+// set, the MessageId is used, otherwise a hash of the body, the properties
+// and the timestamp of the message.
+func MessageKey(message TapMessage) string {
+	m := message.AmqpMessage
+	if m.MessageId != "" {
+		return "id:" + m.MessageId
+	}
+	h := sha256.New()
+	_, _ = h.Write(m.Body)
+	// maps are printed with sorted keys, so the headers are hashed stable
+	_, _ = fmt.Fprintf(h, "%v|%s|%s|%d|%d|%s|%s|%s|%s|%s|%s|%s",
+		m.Headers, m.ContentType, m.ContentEncoding, m.DeliveryMode,
+		m.Priority, m.CorrelationId, m.ReplyTo, m.Expiration,
+		m.Timestamp.UTC().Format(time.RFC3339Nano), m.Type, m.UserId, m.AppId)
+	return "hash:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// pendingMessage is a message held back by DeduplicateMessages
+type pendingMessage struct {
+	message TapMessage
+	expires time.Time
+}
+
+// DeduplicateMessages suppresses duplicates of messages, e.g. received
+// through overlapping taps. Each message is held back for the given window,
+// during which all duplicates (see MessageKey) are dropped. After the window,
+// the message is passed on with Paths set to the number of times it was
+// received. All received messages are acknowledged on receipt, since the
+// suppressed duplicates never reach the consumer. When the input channel is
+// closed, all pending messages are passed on. When ctx is cancelled, the
+// consumer no longer receives, so the pending messages are dropped and their
+// number is logged. The returned channel is closed in both cases.
+func DeduplicateMessages(ctx context.Context,
+	in TapChannel,
+	window time.Duration,
+	logger *slog.Logger,
+) TapChannel {
+	out := make(TapChannel)
+	go func() {
+		pending := map[string]*pendingMessage{}
+		var order []string // keys of pending messages, oldest first
+		timer := time.NewTimer(window)
+		defer timer.Stop()
+		defer func() {
+			if len(order) > 0 {
+				logger.Warn("pending messages dropped, since tap was cancelled", "dropped", len(order))
+			}
+			close(out)
+		}()
+
+		// emit passes the oldest pending message on
+		emit := func() bool {
+			key := order[0]
+			select {
+			case out <- pending[key].message:
+				order = order[1:]
+				delete(pending, key)
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		resetTimer := func() {
+			if len(order) > 0 {
+				timer.Reset(time.Until(pending[order[0]].expires))
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+				for len(order) > 0 && !pending[order[0]].expires.After(time.Now()) {
+					if !emit() {
+						return
+					}
+				}
+				resetTimer()
+			case message, more := <-in:
+				if !more {
+					for len(order) > 0 {
+						if !emit() {
+							return
+						}
+					}
+					return
+				}
+				if err := message.AmqpMessage.Ack(false); err != nil {
+					logger.Error("ACK failed", "error", err)
+				}
+				key := MessageKey(message)
+				if p, found := pending[key]; found {
+					p.message.Paths++
+					logger.Debug("duplicate message suppressed", "key", key, "source", message.Source)
+					continue
+				}
+				message.Paths = 1
+				pending[key] = &pendingMessage{message: message, expires: time.Now().Add(window)}
+				order = append(order, key)
+				if len(order) == 1 {
+					resetTimer()
+				}
+			}
+		}
+	}()
+	return out
+}
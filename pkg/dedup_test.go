@@ -0,0 +1,134 @@
+package rabtap
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingAcknowledger struct{ acks atomic.Int32 }
+
+func (s *countingAcknowledger) Ack(tag uint64, multiple bool) error {
+	s.acks.Add(1)
+	return nil
+}
+
+func (s *countingAcknowledger) Nack(tag uint64, multiple, requeue bool) error { return nil }
+
+func (s *countingAcknowledger) Reject(tag uint64, requeue bool) error { return nil }
+
+func TestMessageKeyUsesMessageIDIfSet(t *testing.T) {
+	m1 := TapMessage{AmqpMessage: &amqp.Delivery{MessageId: "123", Body: []byte("a")}}
+	m2 := TapMessage{AmqpMessage: &amqp.Delivery{MessageId: "123", Body: []byte("b")}}
+
+	assert.Equal(t, "id:123", MessageKey(m1))
+	assert.Equal(t, MessageKey(m1), MessageKey(m2))
+}
+
+func TestMessageKeyHashesBodyPropertiesAndTimestamp(t *testing.T) {
+	ts := time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+	message := func(body, contentType string, ts time.Time) TapMessage {
+		return TapMessage{AmqpMessage: &amqp.Delivery{
+			Body:        []byte(body),
+			ContentType: contentType,
+			Timestamp:   ts,
+			Headers:     amqp.Table{"a": "1", "b": "2"},
+			// exchange and routing key are not part of the key
+			Exchange:   body,
+			RoutingKey: body,
+		}}
+	}
+
+	key := MessageKey(message("body", "text/plain", ts))
+
+	assert.Equal(t, key, MessageKey(message("body", "text/plain", ts)))
+	assert.NotEqual(t, key, MessageKey(message("other", "text/plain", ts)))
+	assert.NotEqual(t, key, MessageKey(message("body", "application/json", ts)))
+	assert.NotEqual(t, key, MessageKey(message("body", "text/plain", ts.Add(time.Second))))
+}
+
+func TestDeduplicateMessagesSuppressesDuplicatesWithinWindow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	acknowledger := &countingAcknowledger{}
+	in := make(TapChannel)
+	out := DeduplicateMessages(ctx, in, 100*time.Millisecond, slog.New(slog.DiscardHandler))
+
+	send := func(id string, source string) {
+		in <- TapMessage{
+			AmqpMessage: &amqp.Delivery{Acknowledger: acknowledger, MessageId: id},
+			Source:      &TapSource{Exchange: source},
+		}
+	}
+	send("1", "exchange1")
+	send("1", "exchange2")
+	send("2", "exchange1")
+	send("1", "exchange3")
+
+	first := <-out
+	assert.Equal(t, "1", first.AmqpMessage.MessageId)
+	assert.Equal(t, 3, first.Paths)
+	assert.Equal(t, "exchange1", first.Source.Exchange)
+
+	second := <-out
+	assert.Equal(t, "2", second.AmqpMessage.MessageId)
+	assert.Equal(t, 1, second.Paths)
+
+	assert.Equal(t, int32(4), acknowledger.acks.Load())
+}
+
+func TestDeduplicateMessagesPassesOnMessagesReceivedAfterWindow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(TapChannel)
+	out := DeduplicateMessages(ctx, in, 10*time.Millisecond, slog.New(slog.DiscardHandler))
+
+	message := TapMessage{AmqpMessage: &amqp.Delivery{Acknowledger: &countingAcknowledger{}, MessageId: "1"}}
+	in <- message
+	assert.Equal(t, 1, (<-out).Paths)
+	in <- message
+	assert.Equal(t, 1, (<-out).Paths)
+}
+
+func TestDeduplicateMessagesFlushesPendingMessagesWhenInputIsClosed(t *testing.T) {
+	in := make(TapChannel)
+	out := DeduplicateMessages(context.Background(), in, time.Hour, slog.New(slog.DiscardHandler))
+
+	in <- TapMessage{AmqpMessage: &amqp.Delivery{Acknowledger: &countingAcknowledger{}, MessageId: "1"}}
+	close(in)
+
+	select {
+	case message, more := <-out:
+		require.True(t, more)
+		assert.Equal(t, "1", message.AmqpMessage.MessageId)
+	case <-time.After(2 * time.Second):
+		assert.Fail(t, "pending message not flushed")
+	}
+	_, more := <-out
+	assert.False(t, more)
+}
+
+func TestDeduplicateMessagesReportsDroppedMessagesWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(TapChannel)
+	var log bytes.Buffer
+	out := DeduplicateMessages(ctx, in, time.Hour, slog.New(slog.NewTextHandler(&log, nil)))
+
+	in <- TapMessage{AmqpMessage: &amqp.Delivery{Acknowledger: &countingAcknowledger{}, MessageId: "1"}}
+	cancel()
+
+	select {
+	case _, more := <-out:
+		assert.False(t, more)
+	case <-time.After(2 * time.Second):
+		assert.Fail(t, "channel not closed")
+	}
+	assert.Contains(t, log.String(), "dropped=1")
+}
@@ -5,16 +5,29 @@ package rabtap
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// VhostFromURL returns the vhost of the given AMQP URL, defaulting to "/"
+// when no vhost is part of the URL.
+func VhostFromURL(amqpURL *url.URL) (string, error) {
+	uri, err := amqp.ParseURI(amqpURL.String())
+	if err != nil {
+		return "", err
+	}
+	return uri.Vhost, nil
+}
+
 // DiscoverBindingsForExchange returns a string list of routing-keys that
 // are used by the given exchange and broker. This list can be used to
 // auto-tap to all queues on a given exchange
 func DiscoverBindingsForExchange(ctx context.Context, rabbitAPIClient *RabbitHTTPClient, vhost, exchangeName string) ([]string, error) {
 
-	var bindingKeys []string
 	exchanges, err := rabbitAPIClient.Exchanges(ctx)
 
 	if err != nil {
@@ -22,30 +35,41 @@ func DiscoverBindingsForExchange(ctx context.Context, rabbitAPIClient *RabbitHTT
 	}
 
 	// find type of given exchange
-	var exchangeType *string
-	for _, exchange := range exchanges {
-		if exchange.Name == exchangeName && exchange.Vhost == vhost {
-			exchangeType = &exchange.Type
+	var exchange *RabbitExchange
+	for i := range exchanges {
+		if exchanges[i].Name == exchangeName && exchanges[i].Vhost == vhost {
+			exchange = &exchanges[i]
 			break
 		}
 	}
 
-	if exchangeType == nil {
+	if exchange == nil {
 		return nil, errors.New("exchange " + exchangeName + " on vhost " +
 			vhost + " not found")
 	}
 
-	switch *exchangeType {
-	case amqp.ExchangeDirect:
-		// filter out all bindings for given exchange
-		bindings, err := rabbitAPIClient.Bindings(ctx)
-
-		if err != nil {
+	var bindings []RabbitBinding
+	if exchange.Type == amqp.ExchangeDirect {
+		if bindings, err = rabbitAPIClient.Bindings(ctx); err != nil {
 			return nil, err
 		}
+	}
+	return bindingKeysForExchange(*exchange, bindings)
+}
 
+// bindingKeysForExchange returns the binding keys to use to tap all messages
+// sent to the given exchange. The bindings are only needed for exchanges of
+// type direct, where each bound key must be tapped.
+func bindingKeysForExchange(exchange RabbitExchange, bindings []RabbitBinding) ([]string, error) {
+	var bindingKeys []string
+
+	switch exchange.Type {
+	case amqp.ExchangeDirect:
+		// multiple queues can be bound using the same key, which we must
+		// tap only once to not receive messages multiple times.
 		for _, binding := range bindings {
-			if binding.Source == exchangeName {
+			if binding.Source == exchange.Name && binding.Vhost == exchange.Vhost &&
+				!slices.Contains(bindingKeys, binding.RoutingKey) {
 				bindingKeys = append(bindingKeys, binding.RoutingKey)
 			}
 		}
@@ -56,6 +80,79 @@ func DiscoverBindingsForExchange(ctx context.Context, rabbitAPIClient *RabbitHTT
 		return []string{""}, nil
 	}
 
-	return nil, errors.New("exchange '" + exchangeName + "': unknown type " +
-		*exchangeType)
+	return nil, errors.New("exchange '" + exchange.Name + "': unknown type " +
+		exchange.Type)
+}
+
+// isTappableExchange returns false for exchanges which can not or should
+// not be tapped: the default exchange, internal exchanges and the exchanges
+// created by rabtap itself for tapping.
+func isTappableExchange(exchange RabbitExchange) bool {
+	return exchange.Name != "" && !exchange.Internal &&
+		!strings.HasPrefix(exchange.Name, DefaultTapNamePrefix)
+}
+
+// DiscoverExchanges returns exchange configurations to tap all exchanges of
+// the given vhost, for which the given filter returns true. Exchanges that
+// can not be tapped (see isTappableExchange) and direct exchanges without
+// bindings are skipped.
+func DiscoverExchanges(ctx context.Context, rabbitAPIClient *RabbitHTTPClient,
+	vhost string, filter func(RabbitExchange) (bool, error),
+) ([]ExchangeConfiguration, error) {
+	exchanges, err := rabbitAPIClient.Exchanges(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := rabbitAPIClient.Bindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []ExchangeConfiguration
+	for _, exchange := range exchanges {
+		if exchange.Vhost != vhost || !isTappableExchange(exchange) {
+			continue
+		}
+		passed, err := filter(exchange)
+		if err != nil {
+			return nil, fmt.Errorf("exchange filter: %w", err)
+		}
+		if !passed {
+			continue
+		}
+		bindingKeys, err := bindingKeysForExchange(exchange, bindings)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range bindingKeys {
+			result = append(result, ExchangeConfiguration{Exchange: exchange.Name, BindingKey: key})
+		}
+	}
+	return result, nil
+}
+
+// DiscoverExchangeConfigurations returns the given exchange configurations,
+// where each configuration with DiscoverBindings set is replaced by one
+// configuration per binding key found by DiscoverBindingsForExchange.
+func DiscoverExchangeConfigurations(ctx context.Context, rabbitAPIClient *RabbitHTTPClient,
+	vhost string, exchangeConfigs []ExchangeConfiguration,
+) ([]ExchangeConfiguration, error) {
+	var result []ExchangeConfiguration
+	for _, config := range exchangeConfigs {
+		if !config.DiscoverBindings {
+			result = append(result, config)
+			continue
+		}
+		bindingKeys, err := DiscoverBindingsForExchange(ctx, rabbitAPIClient, vhost, config.Exchange)
+		if err != nil {
+			return nil, fmt.Errorf("discover bindings: %w", err)
+		}
+		if len(bindingKeys) == 0 {
+			return nil, errors.New("exchange '" + config.Exchange + "': no bindings found")
+		}
+		for _, key := range bindingKeys {
+			result = append(result, ExchangeConfiguration{Exchange: config.Exchange, BindingKey: key})
+		}
+	}
+	return result, nil
 }
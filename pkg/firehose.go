@@ -0,0 +1,165 @@
+// decode messages received from the RabbitMQ FireHose tracer.
+// (see https://www.rabbitmq.com/firehose.html)
+// Copyright (C) 2026 Jan Delgado
+
+package rabtap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// FireHoseExchange is the exchange the FireHose tracer sends traced messages to
+const FireHoseExchange = "amq.rabbitmq.trace"
+
+const (
+	// FireHoseEventPublish is the event of a message published to an exchange
+	FireHoseEventPublish = "publish"
+	// FireHoseEventDeliver is the event of a message delivered from a queue
+	FireHoseEventDeliver = "deliver"
+)
+
+// TraceInfo holds the FireHose tracer information of a decoded message
+type TraceInfo struct {
+	Event        string   // publish or deliver
+	Queue        string   // deliver: queue the message was delivered from
+	RoutedQueues []string // publish: queues the message was routed to
+	Node         string
+	User         string
+	Connection   string
+}
+
+// FireHoseBindingKey returns the binding key on the FireHose exchange for
+// the given event, which is either "publish", "deliver" or a more specific
+// binding key like "publish.EXCHANGE" or "deliver.QUEUE"
+func FireHoseBindingKey(event string) string {
+	switch event {
+	case FireHoseEventPublish, FireHoseEventDeliver:
+		return event + ".#"
+	default:
+		return event
+	}
+}
+
+// tableInt converts the integer types used in amqp.Tables to an int64
+func tableInt(v interface{}) int64 {
+	switch x := v.(type) {
+	case int:
+		return int64(x)
+	case int8:
+		return int64(x)
+	case uint8:
+		return int64(x)
+	case int16:
+		return int64(x)
+	case uint16:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case int64:
+		return x
+	default:
+		return 0
+	}
+}
+
+func tableString(t amqp.Table, key string) string {
+	s, _ := t[key].(string)
+	return s
+}
+
+func tableStrings(t amqp.Table, key string) []string {
+	values, _ := t[key].([]interface{})
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func tableTimestamp(t amqp.Table, key string) time.Time {
+	switch x := t[key].(type) {
+	case time.Time:
+		return x
+	case nil:
+		return time.Time{}
+	default:
+		return time.Unix(tableInt(x), 0)
+	}
+}
+
+// IsFireHoseMessage returns true if the given message was received from the
+// FireHose exchange
+func IsFireHoseMessage(message TapMessage) bool {
+	return message.AmqpMessage.Exchange == FireHoseExchange
+}
+
+// DecodeFireHoseMessage takes a message received from the FireHose exchange
+// and returns the original message, annotated with the trace information.
+// The meta data of the original message is stored in the headers of the
+// traced message, the event and queue or exchange name in the routing key.
+func DecodeFireHoseMessage(message TapMessage) (TapMessage, error) {
+	m := message.AmqpMessage
+	event, name, found := strings.Cut(m.RoutingKey, ".")
+	if !found || (event != FireHoseEventPublish && event != FireHoseEventDeliver) {
+		return message, fmt.Errorf("unexpected routing key %q on firehose message", m.RoutingKey)
+	}
+	props, ok := m.Headers["properties"].(amqp.Table)
+	if !ok {
+		return message, fmt.Errorf("headers.properties attribute missing")
+	}
+
+	routingKeys := tableStrings(m.Headers, "routing_keys")
+	routingKey := ""
+	if len(routingKeys) > 0 {
+		routingKey = routingKeys[0]
+	}
+	headers, _ := props["headers"].(amqp.Table)
+
+	trace := &TraceInfo{
+		Event:      event,
+		Node:       tableString(m.Headers, "node"),
+		User:       tableString(m.Headers, "user"),
+		Connection: tableString(m.Headers, "connection"),
+	}
+	if event == FireHoseEventDeliver {
+		trace.Queue = name
+	} else {
+		trace.RoutedQueues = tableStrings(m.Headers, "routed_queues")
+	}
+
+	return TapMessage{
+		AmqpMessage: &amqp.Delivery{
+			Acknowledger:    m.Acknowledger,
+			Headers:         headers,
+			ContentType:     tableString(props, "content_type"),
+			ContentEncoding: tableString(props, "content_encoding"),
+			DeliveryMode:    uint8(tableInt(props["delivery_mode"])),
+			Priority:        uint8(tableInt(props["priority"])),
+			CorrelationId:   tableString(props, "correlation_id"),
+			ReplyTo:         tableString(props, "reply_to"),
+			Expiration:      tableString(props, "expiration"),
+			MessageId:       tableString(props, "message_id"),
+			Timestamp:       tableTimestamp(props, "timestamp"),
+			Type:            tableString(props, "type"),
+			UserId:          tableString(props, "user_id"),
+			AppId:           tableString(props, "app_id"),
+			ConsumerTag:     m.ConsumerTag,
+			DeliveryTag:     m.DeliveryTag,
+			Redelivered:     tableInt(m.Headers["redelivered"]) != 0,
+			Exchange:        tableString(m.Headers, "exchange_name"),
+			RoutingKey:      routingKey,
+			Body:            m.Body,
+		},
+		ReceivedTimestamp: message.ReceivedTimestamp,
+		Trace:             trace,
+		Source:            message.Source,
+	}, nil
+}
@@ -0,0 +1,144 @@
+package rabtap
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFireHoseBindingKeyExpandsEvents(t *testing.T) {
+	assert.Equal(t, "publish.#", FireHoseBindingKey("publish"))
+	assert.Equal(t, "deliver.#", FireHoseBindingKey("deliver"))
+	assert.Equal(t, "publish.amq.topic", FireHoseBindingKey("publish.amq.topic"))
+	assert.Equal(t, "deliver.q1", FireHoseBindingKey("deliver.q1"))
+}
+
+func TestIsFireHoseMessageDetectsMessagesFromFireHose(t *testing.T) {
+	assert.True(t, IsFireHoseMessage(TapMessage{AmqpMessage: &amqp.Delivery{Exchange: "amq.rabbitmq.trace"}}))
+	assert.False(t, IsFireHoseMessage(TapMessage{AmqpMessage: &amqp.Delivery{Exchange: "amq.topic"}}))
+}
+
+func TestDecodeFireHoseMessageDecodesPublishedMessage(t *testing.T) {
+	ts := time.Date(2026, time.October, 1, 12, 0, 0, 0, time.UTC)
+	received := time.Date(2026, time.October, 1, 12, 0, 1, 0, time.UTC)
+	message := TapMessage{
+		AmqpMessage: &amqp.Delivery{
+			Exchange:    "amq.rabbitmq.trace",
+			RoutingKey:  "publish.",
+			DeliveryTag: 42,
+			Headers: amqp.Table{
+				"exchange_name": "",
+				"routing_keys":  []interface{}{"q1"},
+				"routed_queues": []interface{}{"q1"},
+				"node":          "rabbit@node",
+				"user":          "guest",
+				"connection":    "127.0.0.1:1234 -> 127.0.0.1:5672",
+				"properties": amqp.Table{
+					"headers":          amqp.Table{"a": "b"},
+					"content_type":     "text/plain",
+					"content_encoding": "gzip",
+					"delivery_mode":    uint8(2),
+					"priority":         uint8(5),
+					"correlation_id":   "corr",
+					"reply_to":         "reply",
+					"expiration":       "1000",
+					"message_id":       "msgid",
+					"timestamp":        ts,
+					"type":             "type",
+					"user_id":          "guest",
+					"app_id":           "app",
+				},
+			},
+			Body: []byte("Hello"),
+		},
+		ReceivedTimestamp: received,
+	}
+
+	decoded, err := DecodeFireHoseMessage(message)
+
+	require.NoError(t, err)
+	assert.Equal(t, &amqp.Delivery{
+		Headers:         amqp.Table{"a": "b"},
+		ContentType:     "text/plain",
+		ContentEncoding: "gzip",
+		DeliveryMode:    2,
+		Priority:        5,
+		CorrelationId:   "corr",
+		ReplyTo:         "reply",
+		Expiration:      "1000",
+		MessageId:       "msgid",
+		Timestamp:       ts,
+		Type:            "type",
+		UserId:          "guest",
+		AppId:           "app",
+		DeliveryTag:     42,
+		Exchange:        "",
+		RoutingKey:      "q1",
+		Body:            []byte("Hello"),
+	}, decoded.AmqpMessage)
+	assert.Equal(t, received, decoded.ReceivedTimestamp)
+	assert.Equal(t, &TraceInfo{
+		Event:        "publish",
+		RoutedQueues: []string{"q1"},
+		Node:         "rabbit@node",
+		User:         "guest",
+		Connection:   "127.0.0.1:1234 -> 127.0.0.1:5672",
+	}, decoded.Trace)
+}
+
+func TestDecodeFireHoseMessageDecodesDeliveredMessage(t *testing.T) {
+	message := TapMessage{
+		AmqpMessage: &amqp.Delivery{
+			Exchange:   "amq.rabbitmq.trace",
+			RoutingKey: "deliver.my.queue",
+			Headers: amqp.Table{
+				"exchange_name": "amq.topic",
+				"routing_keys":  []interface{}{"key"},
+				"redelivered":   int32(1),
+				"properties":    amqp.Table{"timestamp": int64(123456)},
+			},
+		},
+		Source: &TapSource{Exchange: "amq.rabbitmq.trace", BindingKey: "deliver.#"},
+	}
+
+	decoded, err := DecodeFireHoseMessage(message)
+
+	require.NoError(t, err)
+	assert.Equal(t, "amq.topic", decoded.AmqpMessage.Exchange)
+	assert.Equal(t, "key", decoded.AmqpMessage.RoutingKey)
+	assert.True(t, decoded.AmqpMessage.Redelivered)
+	assert.Equal(t, time.Unix(123456, 0), decoded.AmqpMessage.Timestamp)
+	assert.Equal(t, "deliver", decoded.Trace.Event)
+	assert.Equal(t, "my.queue", decoded.Trace.Queue)
+	assert.Empty(t, decoded.Trace.RoutedQueues)
+	assert.Equal(t, message.Source, decoded.Source)
+}
+
+func TestDecodeFireHoseMessageFailsOnUnexpectedRoutingKey(t *testing.T) {
+	message := TapMessage{
+		AmqpMessage: &amqp.Delivery{
+			RoutingKey: "unknown",
+			Headers:    amqp.Table{"properties": amqp.Table{}},
+		},
+	}
+
+	_, err := DecodeFireHoseMessage(message)
+
+	assert.ErrorContains(t, err, "unexpected routing key")
+}
+
+func TestDecodeFireHoseMessageFailsWithoutProperties(t *testing.T) {
+	message := TapMessage{
+		AmqpMessage: &amqp.Delivery{
+			RoutingKey: "publish.amq.topic",
+			Headers:    amqp.Table{},
+		},
+	}
+
+	_, err := DecodeFireHoseMessage(message)
+
+	assert.ErrorContains(t, err, "headers.properties attribute missing")
+}
@@ -23,6 +23,18 @@ const (
 type PublishMessage struct {
 	Routing    Routing
 	Publishing *amqp.Publishing
+	// Confirmed is optionally called with the outcome of the publishing: true,
+	// when the broker confirmed the message or the transaction was committed,
+	// false when the message was nacked, returned, the transaction was rolled
+	// back or publishing failed. Without publisher confirms and transactions,
+	// true is passed as soon as the message was published.
+	Confirmed func(ack bool)
+}
+
+func (s *PublishMessage) confirm(ack bool) {
+	if s.Confirmed != nil {
+		s.Confirmed(ack)
+	}
 }
 
 // PublishChannel is a channel for PublishMessage message objects
@@ -34,6 +46,14 @@ type AmqpPublish struct {
 	connection *AmqpConnector
 	mandatory  bool
 	confirms   bool
+	// confirmWindow is the max. number of messages waiting for a confirm
+	confirmWindow int
+	// blockedTimeout is the max. time publishing is paused by the broker
+	// before publishing fails. 0 waits forever.
+	blockedTimeout time.Duration
+	// txBatchSize is the number of messages published in a transaction. 0
+	// disables transactions.
+	txBatchSize int
 }
 
 type PublishErrorReason int
@@ -44,6 +64,8 @@ const (
 	PublishErrorPublishFailed
 	PublishErrorReturned
 	PublishErrorChannelError
+	PublishErrorBlocked
+	PublishErrorTxRollback
 )
 
 // PublishError is sent back trough the error channel when there are problems
@@ -51,11 +73,12 @@ const (
 type PublishError struct {
 	Reason PublishErrorReason
 	// Publishing stores the original message, if available (AckTimeout, Nack,
-	// PublishFailed)
+	// PublishFailed, and Returned when confirms are enabled)
 	Message *PublishMessage
 	// ReturnedMessage stores the returned message in case of PublishErrorReturned
 	ReturnedMessage *amqp.Return
-	// Cause holds the error when a ChannelError happened
+	// Cause holds the error when a ChannelError happened, publishing was
+	// blocked too long or a transaction was rolled back
 	Cause error
 }
 
@@ -82,6 +105,10 @@ func (s *PublishError) Error() string {
 			routing, s.ReturnedMessage.ReplyText)
 	case PublishErrorChannelError:
 		return fmt.Sprintf("channel error: %s", s.Cause)
+	case PublishErrorBlocked:
+		return fmt.Sprintf("publishing blocked: %s", s.Cause)
+	case PublishErrorTxRollback:
+		return fmt.Sprintf("transaction rolled back: %s", s.Cause)
 	}
 	return "unexpected error"
 }
@@ -96,9 +123,36 @@ func NewAmqpPublish(url *url.URL, tlsConfig *tls.Config,
 		mandatory:  mandatory,
 		confirms:   confirms,
 		logger:     logger,
+		// wait for the confirmation before publishing a new message
+		confirmWindow: 1,
 	}
 }
 
+// WithConfirmWindow sets the max. number of published messages waiting for
+// a confirmation of the broker, when publisher confirms are enabled. A
+// larger window increases the throughput, since messages are published
+// without waiting for the confirmations of the previous messages.
+func (s *AmqpPublish) WithConfirmWindow(window int) *AmqpPublish {
+	s.confirmWindow = max(1, window)
+	return s
+}
+
+// WithBlockedTimeout sets the max. time publishing is paused, because the
+// broker blocked the connection or stopped the channel flow, before
+// publishing fails with a PublishErrorBlocked error. 0 waits forever.
+func (s *AmqpPublish) WithBlockedTimeout(timeout time.Duration) *AmqpPublish {
+	s.blockedTimeout = timeout
+	return s
+}
+
+// WithTransactions enables transactions, committing every batchSize
+// messages and when the publish channel is closed. Must not be combined with
+// publisher confirms.
+func (s *AmqpPublish) WithTransactions(batchSize int) *AmqpPublish {
+	s.txBatchSize = max(1, batchSize)
+	return s
+}
+
 // createWorkerFunc creates a function that receives messages on the provided
 // channel and publishes the messages on an rabbitmq exchange
 //
@@ -117,8 +171,25 @@ func NewAmqpPublish(url *url.URL, tlsConfig *tls.Config,
 // The immedeate flag is not supported since RabbitMQ 3.0, see
 // https://blog.rabbitmq.com/posts/2012/11/breaking-things-with-rabbitmq-3-0
 //
-// TODO detect throttling
-// TODO simplify
+// Publisher confirms:
+// When confirms are enabled, up to confirmWindow messages are published
+// before waiting for their confirmations. Each confirmation is matched by its
+// delivery tag to the published message, whose Confirmed callback is called.
+// Returned messages are matched by their content, see markReturned.
+//
+// Transactions:
+// When transactions are enabled, the channel is put into tx mode and a
+// transaction is committed after txBatchSize messages were published, and
+// when the publish channel is closed. If the commit fails, the transaction is
+// rolled back and the Confirmed callbacks of its messages are called with
+// false. Messages of a transaction not yet committed when the channel fails
+// or publishing is stopped are discarded by the broker and handled the same.
+// Messages returned by the broker are committed, but confirmed with false.
+//
+// Flow control:
+// When the broker blocks the connection, e.g. due to a memory or disk alarm,
+// or stops the flow of the channel, no messages are read from the publish
+// channel until publishing is resumed, which pauses the message source.
 func (s *AmqpPublish) createWorkerFunc(
 	publishCh PublishChannel,
 	errorCh PublishErrorChannel,
@@ -127,15 +198,24 @@ func (s *AmqpPublish) createWorkerFunc(
 		// errors receives channel errors (e.g. publishing to non-existant exchange)
 		errors := session.Channel.NotifyClose(make(chan *amqp.Error, 1))
 		// return receivces unroutable messages back from the server
-		returns := session.NotifyReturn(make(chan amqp.Return, 1))
+		// (in tx mode, all returns of a transaction arrive before the commit)
+		returns := session.NotifyReturn(make(chan amqp.Return, max(1, s.txBatchSize)))
 		// confirms receives confirmations from the server (if enabled below)
-		confirms := session.NotifyPublish(make(chan amqp.Confirmation, 1))
+		confirms := session.NotifyPublish(make(chan amqp.Confirmation, s.confirmWindow))
+		// blockings and flows receive flow control notifications
+		blockings := session.Connection.NotifyBlocked(make(chan amqp.Blocking, 1))
+		flows := session.Channel.NotifyFlow(make(chan bool, 1))
 
 		if s.confirms {
 			if err := session.Confirm(false); err != nil {
 				s.logger.Error("Channel could not be put into confirm mode", "error", err)
 			}
 		}
+		if s.txBatchSize > 0 {
+			if err := session.Tx(); err != nil {
+				s.logger.Error("Channel could not be put into tx mode", "error", err)
+			}
+		}
 
 		// wait a while for outstanding errors and returned messages
 		// since these can arrive after we finished publishing.
@@ -165,32 +245,174 @@ func (s *AmqpPublish) createWorkerFunc(
 			}
 		}()
 
+		// messages published in confirm mode and waiting for a confirmation.
+		// Up to confirmWindow messages are published without waiting.
+		// See https://www.rabbitmq.com/confirms.html
+		var inflight inflightMessages
+		rejectInflight := func() {
+			for _, m := range inflight.removeAll() {
+				m.message.confirm(false)
+			}
+		}
+		// messages still in flight when the worker ends, e.g. when ctx is
+		// cancelled, are not confirmed
+		defer rejectInflight()
 		ackTimeout := time.NewTimer(timeoutWaitACK)
 		defer ackTimeout.Stop()
 
-		for {
+		var throttle publishThrottle
+		blockedTimeout := time.NewTimer(s.blockedTimeout)
+		defer blockedTimeout.Stop()
+
+		// the broker can not confirm messages while publishing is paused
+		onResume := func(pause time.Duration) {
+			if pause > 0 {
+				s.logger.Info("publishing resumed", "paused", pause)
+				inflight.delay(pause)
+			}
+		}
+
+		// "For unroutable messages, the broker will issue a confirm once the
+		// exchange verifies a message won't route to any queue (returns an
+		// empty list of queues). If the message is also published as
+		// mandatory, the basic.return is sent to the client before
+		// basic.ack. The same is true for negative acknowledgements
+		// (basic.nack)."
+		// messages published in the current transaction. Returned messages
+		// are committed too, but not confirmed.
+		var tx inflightMessages
+		rejectTx := func() {
+			for _, m := range tx.removeAll() {
+				m.message.confirm(false)
+			}
+		}
+
+		onReturn := func(returned amqp.Return) {
+			message := inflight.markReturned(&returned)
+			if message == nil {
+				message = tx.markReturned(&returned)
+			}
+			errorCh <- &PublishError{Reason: PublishErrorReturned,
+				Message: message, ReturnedMessage: &returned}
+		}
+		onConfirm := func(confirmed amqp.Confirmation) {
+			drainReturns(returns, onReturn)
+			for _, m := range inflight.confirm(confirmed.DeliveryTag) {
+				if !confirmed.Ack {
+					errorCh <- &PublishError{Reason: PublishErrorNack, Message: m.message}
+				} else {
+					s.logger.Info("delivery was ACKed by the server",
+						"delivery_tag", confirmed.DeliveryTag)
+				}
+				// a returned message is still ACKed by the server
+				m.message.confirm(confirmed.Ack && !m.returned)
+			}
+		}
+
+		commitTx := func() {
+			if tx.len() == 0 {
+				return
+			}
+			if err := session.TxCommit(); err != nil {
+				errorCh <- &PublishError{Reason: PublishErrorTxRollback,
+					Cause: fmt.Errorf("commit of %d messages failed: %w", tx.len(), err)}
+				if err := session.TxRollback(); err != nil {
+					s.logger.Debug("rollback failed", "error", err)
+				}
+				rejectTx()
+				return
+			}
+			s.logger.Info("transaction committed", "messages", tx.len())
+			// all returns of the transaction were received before the commit
+			drainReturns(returns, onReturn)
+			for _, m := range tx.removeAll() {
+				m.message.confirm(!m.returned)
+			}
+		}
+		defer rejectTx()
+
+		closed := false // publishCh was closed, wait for outstanding confirms
+		for !closed || inflight.len() > 0 {
+			in := publishCh
+			if closed || throttle.paused() || (s.confirms && inflight.len() >= s.confirmWindow) {
+				in = nil
+			}
+			var timeout <-chan time.Time
+			if inflight.len() > 0 && !throttle.paused() {
+				ackTimeout.Reset(time.Until(inflight.nextTimeout(timeoutWaitACK)))
+				timeout = ackTimeout.C
+			}
+			var blocked <-chan time.Time
+			if throttle.paused() && s.blockedTimeout > 0 {
+				blockedTimeout.Reset(time.Until(throttle.since.Add(s.blockedTimeout)))
+				blocked = blockedTimeout.C
+			}
+
 			select {
 			case err := <-errors:
 				// all errors render the channel invalid, so reconnect
 				errorCh <- &PublishError{Reason: PublishErrorChannelError, Cause: err}
+				rejectInflight()
 				return doReconnect, fmt.Errorf("channel error: %w", err)
 
 			case returned, more := <-returns:
 				if more {
-					errorCh <- &PublishError{Reason: PublishErrorReturned, ReturnedMessage: &returned}
+					onReturn(returned)
+				}
+
+			case confirmed, more := <-confirms:
+				if !more {
+					confirms = nil // channel closed, pending messages will time out
+					continue
 				}
+				onConfirm(confirmed)
 
-			case message, more := <-publishCh:
+			case blocking, more := <-blockings:
+				if !more {
+					blockings = nil
+					continue
+				}
+				if blocking.Active {
+					s.logger.Warn("connection blocked by broker, publishing paused", "reason", blocking.Reason)
+				}
+				onResume(throttle.setBlocked(blocking.Active, blocking.Reason, time.Now()))
+
+			case active, more := <-flows:
+				if !more {
+					flows = nil
+					continue
+				}
+				if !active {
+					s.logger.Warn("channel flow stopped by broker, publishing paused")
+				}
+				onResume(throttle.setFlow(active, time.Now()))
+
+			case <-blocked:
+				err := fmt.Errorf("paused by broker for more than %s (%s)",
+					s.blockedTimeout, throttle.cause())
+				errorCh <- &PublishError{Reason: PublishErrorBlocked, Cause: err}
+				rejectInflight()
+				return doNotReconnect, fmt.Errorf("publishing blocked: %w", err)
+
+			case <-timeout:
+				for _, m := range inflight.expire(time.Now().Add(-timeoutWaitACK)) {
+					errorCh <- &PublishError{Reason: PublishErrorAckTimeout, Message: m.message}
+					m.message.confirm(false)
+				}
+
+			case message, more := <-in:
 				if !more {
 					s.logger.Debug("publishing channel closed.")
-					return doNotReconnect, nil
+					closed = true
+					commitTx()
+					continue
 				}
 
 				size := len((*message.Publishing).Body)
 				s.logger.Debug("publishing message", "routing", message.Routing, "size", size)
 				headers := EnsureAMQPTable(message.Routing.Headers()).(amqp.Table)
 				message.Publishing.Headers = headers
-				err := session.PublishWithContext(
+				confirmation, err := session.PublishWithDeferredConfirmWithContext(
 					ctx,
 					message.Routing.Exchange(),
 					message.Routing.Key(),
@@ -198,51 +420,26 @@ func (s *AmqpPublish) createWorkerFunc(
 					false, // immeadiate flag was removed with RabbitMQ 3
 					*message.Publishing)
 
-				if err != nil {
+				switch {
+				case err != nil:
 					errorCh <- &PublishError{Reason: PublishErrorPublishFailed, Message: message, Cause: err}
-				} else {
-					// wait for the confirmation before publishing a new message
-					// https://www.rabbitmq.com/confirms.html
-					// TODO batched confirms
-					//
-					// "For unroutable messages, the broker will issue a confirm
-					// once the exchange verifies a message won't route to any
-					// queue (returns an empty list of queues). If the message
-					// is also published as mandatory, the basic.return is sent
-					// to the client before basic.ack. The same is true for
-					// negative acknowledgements (basic.nack)."
-					if s.confirms {
-						ackTimeout.Reset(timeoutWaitACK)
-					Outer:
-						for {
-							select {
-							case <-ackTimeout.C:
-								errorCh <- &PublishError{Reason: PublishErrorAckTimeout, Message: message}
-								break Outer
-							case returned, more := <-returns:
-								if more {
-									errorCh <- &PublishError{Reason: PublishErrorReturned, ReturnedMessage: &returned}
-								}
-							case confirmed := <-confirms:
-								if !confirmed.Ack {
-									errorCh <- &PublishError{Reason: PublishErrorNack, Message: message}
-								} else {
-									s.logger.Info("delivery was ACKed by the server",
-										"delivery_tag", confirmed.DeliveryTag)
-								}
-								break Outer
-							case <-ctx.Done():
-								return doNotReconnect, nil
-							}
-						}
+					message.confirm(false)
+				case confirmation != nil:
+					inflight.add(confirmation.DeliveryTag, message, time.Now())
+				case s.txBatchSize > 0:
+					tx.add(0, message, time.Now())
+					if tx.len() >= s.txBatchSize {
+						commitTx()
 					}
+				default:
+					message.confirm(true)
 				}
 
 			case <-ctx.Done():
 				return doNotReconnect, nil
-
 			}
 		}
+		return doNotReconnect, nil
 	}
 }
 
@@ -0,0 +1,121 @@
+// track published messages waiting for a publisher confirm
+// Copyright (C) 2026 Jan Delgado
+
+package rabtap
+
+import (
+	"bytes"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// inflightMessage is a published message waiting for its confirmation
+type inflightMessage struct {
+	tag       uint64
+	message   *PublishMessage
+	published time.Time
+	returned  bool // the broker returned the message (and will still ACK it)
+}
+
+// inflightMessages tracks the messages published in confirm mode, which are
+// not yet confirmed by the broker. Since delivery tags are increasing, the
+// messages are kept in publishing order, oldest first.
+type inflightMessages struct {
+	messages []*inflightMessage
+}
+
+func (s *inflightMessages) len() int {
+	return len(s.messages)
+}
+
+// add adds a message published with the given delivery tag
+func (s *inflightMessages) add(tag uint64, message *PublishMessage, now time.Time) {
+	s.messages = append(s.messages, &inflightMessage{tag: tag, message: message, published: now})
+}
+
+// confirm removes and returns all messages up to and including the given
+// delivery tag, as with a basic.ack or basic.nack with the multiple flag
+// set. Note that the amqp091 library already resolves these into single
+// confirmations, delivered in the order of the delivery tags.
+func (s *inflightMessages) confirm(tag uint64) []*inflightMessage {
+	i := 0
+	for i < len(s.messages) && s.messages[i].tag <= tag {
+		i++
+	}
+	confirmed := s.messages[:i:i]
+	s.messages = s.messages[i:]
+	return confirmed
+}
+
+// markReturned marks the oldest message matching the returned message as
+// returned and returns it. Since a basic.return carries no delivery tag, the
+// message is matched by exchange, routing key and body. Returns nil if no
+// message matches.
+//
+// Identical messages in flight can not be told apart. Since these are routed
+// the same, this only matters when the bindings change while the messages are
+// in flight: then an identical message routed before may be marked instead of
+// the returned one. This can not happen with a confirm window of 1.
+func (s *inflightMessages) markReturned(returned *amqp.Return) *PublishMessage {
+	for _, m := range s.messages {
+		if !m.returned &&
+			m.message.Routing.Exchange() == returned.Exchange &&
+			m.message.Routing.Key() == returned.RoutingKey &&
+			bytes.Equal(m.message.Publishing.Body, returned.Body) {
+			m.returned = true
+			return m.message
+		}
+	}
+	return nil
+}
+
+// drainReturns passes the returned messages already received on returns to
+// onReturn, without blocking. The broker sends the basic.return of a message
+// before its basic.ack, but a select receiving from both channels may pick
+// the ack first, so pending returns must be handled before a confirmation.
+func drainReturns(returns <-chan amqp.Return, onReturn func(amqp.Return)) {
+	for {
+		select {
+		case returned, more := <-returns:
+			if !more {
+				return
+			}
+			onReturn(returned)
+		default:
+			return
+		}
+	}
+}
+
+// expire removes and returns all messages published before the deadline
+func (s *inflightMessages) expire(deadline time.Time) []*inflightMessage {
+	i := 0
+	for i < len(s.messages) && s.messages[i].published.Before(deadline) {
+		i++
+	}
+	expired := s.messages[:i:i]
+	s.messages = s.messages[i:]
+	return expired
+}
+
+// delay postpones the timeouts of all messages by the given duration, e.g.
+// when the broker paused publishing and thus could not confirm the messages
+func (s *inflightMessages) delay(d time.Duration) {
+	for _, m := range s.messages {
+		m.published = m.published.Add(d)
+	}
+}
+
+// removeAll removes and returns all messages
+func (s *inflightMessages) removeAll() []*inflightMessage {
+	all := s.messages
+	s.messages = nil
+	return all
+}
+
+// nextTimeout returns when the oldest message times out, given the timeout.
+// Must only be called when there are messages.
+func (s *inflightMessages) nextTimeout(timeout time.Duration) time.Time {
+	return s.messages[0].published.Add(timeout)
+}
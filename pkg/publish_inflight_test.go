@@ -0,0 +1,136 @@
+package rabtap
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPublishMessage(key, body string) *PublishMessage {
+	return &PublishMessage{
+		Routing:    NewRouting("exchange", key, amqp.Table{}),
+		Publishing: &amqp.Publishing{Body: []byte(body)},
+	}
+}
+
+func tagsOf(messages []*inflightMessage) []uint64 {
+	tags := []uint64{}
+	for _, m := range messages {
+		tags = append(tags, m.tag)
+	}
+	return tags
+}
+
+func TestInflightMessagesConfirmSingleMessage(t *testing.T) {
+	var inflight inflightMessages
+	now := time.Now()
+	inflight.add(1, newTestPublishMessage("a", "1"), now)
+	inflight.add(2, newTestPublishMessage("a", "2"), now)
+
+	confirmed := inflight.confirm(1)
+
+	assert.Equal(t, []uint64{1}, tagsOf(confirmed))
+	assert.Equal(t, 1, inflight.len())
+}
+
+func TestInflightMessagesConfirmMultipleMessages(t *testing.T) {
+	var inflight inflightMessages
+	now := time.Now()
+	for tag := uint64(1); tag <= 4; tag++ {
+		inflight.add(tag, newTestPublishMessage("a", "body"), now)
+	}
+
+	confirmed := inflight.confirm(3)
+
+	assert.Equal(t, []uint64{1, 2, 3}, tagsOf(confirmed))
+	assert.Equal(t, []uint64{4}, tagsOf(inflight.removeAll()))
+	assert.Equal(t, 0, inflight.len())
+}
+
+func TestInflightMessagesConfirmUnknownTagConfirmsNothing(t *testing.T) {
+	var inflight inflightMessages
+	inflight.add(5, newTestPublishMessage("a", "body"), time.Now())
+
+	assert.Empty(t, inflight.confirm(4))
+	assert.Equal(t, 1, inflight.len())
+}
+
+func TestInflightMessagesMarkReturnedMatchesOldestMessageByRoutingAndBody(t *testing.T) {
+	var inflight inflightMessages
+	now := time.Now()
+	first := newTestPublishMessage("a", "body")
+	second := newTestPublishMessage("a", "body")
+	inflight.add(1, newTestPublishMessage("b", "body"), now)
+	inflight.add(2, first, now)
+	inflight.add(3, second, now)
+
+	returned := &amqp.Return{Exchange: "exchange", RoutingKey: "a", Body: []byte("body")}
+
+	assert.Same(t, first, inflight.markReturned(returned))
+	assert.Same(t, second, inflight.markReturned(returned))
+	assert.Nil(t, inflight.markReturned(returned))
+	confirmed := inflight.confirm(3)
+	assert.Equal(t, []bool{false, true, true},
+		[]bool{confirmed[0].returned, confirmed[1].returned, confirmed[2].returned})
+}
+
+func TestDrainReturnsMarksReturnedMessageBeforeAckIsHandled(t *testing.T) {
+	var inflight inflightMessages
+	var acks []bool
+	message := newTestPublishMessage("a", "body")
+	message.Confirmed = func(ack bool) { acks = append(acks, ack) }
+	inflight.add(1, message, time.Now())
+
+	// the return and the ack of the message are received together
+	returns := make(chan amqp.Return, 1)
+	returns <- amqp.Return{Exchange: "exchange", RoutingKey: "a", Body: []byte("body")}
+	confirmed := amqp.Confirmation{DeliveryTag: 1, Ack: true}
+
+	var returned []*PublishMessage
+	drainReturns(returns, func(r amqp.Return) {
+		returned = append(returned, inflight.markReturned(&r))
+	})
+	for _, m := range inflight.confirm(confirmed.DeliveryTag) {
+		m.message.confirm(confirmed.Ack && !m.returned)
+	}
+
+	assert.Equal(t, []*PublishMessage{message}, returned)
+	assert.Equal(t, []bool{false}, acks)
+	assert.Empty(t, returns)
+}
+
+func TestDrainReturnsDoesNotBlockOnEmptyOrClosedChannel(t *testing.T) {
+	onReturn := func(amqp.Return) { t.Fatal("unexpected return") }
+	returns := make(chan amqp.Return)
+
+	drainReturns(returns, onReturn)
+	close(returns)
+	drainReturns(returns, onReturn)
+}
+
+func TestInflightMessagesExpireRemovesMessagesPublishedBeforeDeadline(t *testing.T) {
+	var inflight inflightMessages
+	now := time.Now()
+	inflight.add(1, newTestPublishMessage("a", "1"), now)
+	inflight.add(2, newTestPublishMessage("a", "2"), now.Add(time.Second))
+	inflight.add(3, newTestPublishMessage("a", "3"), now.Add(2*time.Second))
+
+	assert.Equal(t, now.Add(timeoutWaitACK), inflight.nextTimeout(timeoutWaitACK))
+	expired := inflight.expire(now.Add(1500 * time.Millisecond))
+
+	assert.Equal(t, []uint64{1, 2}, tagsOf(expired))
+	assert.Equal(t, now.Add(2*time.Second+timeoutWaitACK), inflight.nextTimeout(timeoutWaitACK))
+}
+
+func TestInflightMessagesDelayPostponesTimeouts(t *testing.T) {
+	var inflight inflightMessages
+	now := time.Now()
+	inflight.add(1, newTestPublishMessage("a", "1"), now)
+
+	inflight.delay(time.Minute)
+
+	assert.Empty(t, inflight.expire(now.Add(time.Second)))
+	assert.Equal(t, now.Add(time.Minute+timeoutWaitACK), inflight.nextTimeout(timeoutWaitACK))
+}
@@ -56,3 +56,224 @@ func TestIntegrationAmqpPublishDirectExchange(t *testing.T) {
 	numReceivedOriginal := <-doneChan
 	assert.Equal(t, numPublishingMessages, numReceivedOriginal)
 }
+
+func TestIntegrationAmqpPublishReportsOutcomeOfConfirmedMessages(t *testing.T) {
+	setup, err := testcommon.IntegrationTestConnection("confirm-exchange", "direct", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	logger := slog.New(slog.DiscardHandler)
+	publisher := NewAmqpPublish(testcommon.IntegrationURIFromEnv(), &tls.Config{}, true, true, logger)
+	publishChannel := make(PublishChannel)
+	errorChannel := make(PublishErrorChannel, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = publisher.EstablishConnection(ctx, publishChannel, errorChannel) }()
+
+	publish := func(key string) bool {
+		acks := make(chan bool, 1)
+		publishChannel <- &PublishMessage{
+			Routing:    NewRouting("confirm-exchange", key, amqp.Table{}),
+			Publishing: &amqp.Publishing{Body: []byte("Hello")},
+			Confirmed:  func(ack bool) { acks <- ack },
+		}
+		return <-acks
+	}
+
+	assert.True(t, publish(setup.QueueName(0)))
+	// an unroutable message is returned, since mandatory is set
+	assert.False(t, publish("unroutable"))
+	assert.Equal(t, PublishErrorReturned, (<-errorChannel).Reason)
+}
+
+func TestIntegrationAmqpPublishMatchesConfirmsWithinWindow(t *testing.T) {
+	setup, err := testcommon.IntegrationTestConnection("confirm-window-exchange", "direct", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	logger := slog.New(slog.DiscardHandler)
+	publisher := NewAmqpPublish(testcommon.IntegrationURIFromEnv(), &tls.Config{}, true, true, logger).
+		WithConfirmWindow(8)
+	publishChannel := make(PublishChannel)
+	errorChannel := make(PublishErrorChannel, numPublishingMessages)
+	done := make(chan error)
+
+	go func() {
+		done <- publisher.EstablishConnection(context.Background(), publishChannel, errorChannel)
+	}()
+
+	// every third message is unroutable and thus returned
+	acks := make([]chan bool, 3*numPublishingMessages)
+	for i := range acks {
+		key := setup.QueueName(0)
+		if i%3 == 0 {
+			key = "unroutable"
+		}
+		ack := make(chan bool, 1)
+		acks[i] = ack
+		publishChannel <- &PublishMessage{
+			Routing:    NewRouting("confirm-window-exchange", key, amqp.Table{}),
+			Publishing: &amqp.Publishing{Body: []byte("Hello")},
+			Confirmed:  func(ok bool) { ack <- ok },
+		}
+	}
+	close(publishChannel)
+	require.NoError(t, <-done)
+
+	for i, ack := range acks {
+		assert.Equal(t, i%3 != 0, <-ack, "message %d", i)
+	}
+	assert.Len(t, errorChannel, numPublishingMessages)
+}
+
+func TestIntegrationAmqpPublishRejectsMessagesInFlightOnCancel(t *testing.T) {
+	setup, err := testcommon.IntegrationTestConnection("confirm-cancel-exchange", "direct", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	logger := slog.New(slog.DiscardHandler)
+	publisher := NewAmqpPublish(testcommon.IntegrationURIFromEnv(), &tls.Config{}, true, true, logger).
+		WithConfirmWindow(10 * numPublishingMessages)
+	publishChannel := make(PublishChannel)
+	errorChannel := make(PublishErrorChannel, numPublishingMessages)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- publisher.EstablishConnection(ctx, publishChannel, errorChannel)
+	}()
+
+	acks := make([]chan bool, 10*numPublishingMessages)
+	for i := range acks {
+		ack := make(chan bool, 1)
+		acks[i] = ack
+		publishChannel <- &PublishMessage{
+			Routing:    NewRouting("confirm-cancel-exchange", setup.QueueName(0), amqp.Table{}),
+			Publishing: &amqp.Publishing{Body: []byte("Hello")},
+			Confirmed:  func(ok bool) { ack <- ok },
+		}
+	}
+	cancel()
+	<-done
+
+	// every message was either confirmed or rejected
+	for i, ack := range acks {
+		assert.Len(t, ack, 1, "message %d", i)
+	}
+}
+
+func TestIntegrationAmqpPublishCommitsTransactionsInBatches(t *testing.T) {
+	setup, err := testcommon.IntegrationTestConnection("tx-exchange", "direct", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	logger := slog.New(slog.DiscardHandler)
+	publisher := NewAmqpPublish(testcommon.IntegrationURIFromEnv(), &tls.Config{}, false, false, logger).
+		WithTransactions(4)
+	publishChannel := make(PublishChannel)
+	errorChannel := make(PublishErrorChannel, numPublishingMessages)
+	done := make(chan error)
+
+	go func() {
+		done <- publisher.EstablishConnection(context.Background(), publishChannel, errorChannel)
+	}()
+
+	key := setup.QueueName(0)
+	acks := make([]chan bool, numPublishingMessages)
+	for i := range acks {
+		ack := make(chan bool, 1)
+		acks[i] = ack
+		publishChannel <- &PublishMessage{
+			Routing:    NewRouting("tx-exchange", key, amqp.Table{}),
+			Publishing: &amqp.Publishing{Body: []byte("Hello")},
+			Confirmed:  func(ok bool) { ack <- ok },
+		}
+	}
+	// the last, incomplete batch is committed when the channel is closed
+	close(publishChannel)
+	require.NoError(t, <-done)
+
+	for i, ack := range acks {
+		assert.True(t, <-ack, "message %d", i)
+	}
+	assert.Empty(t, errorChannel)
+
+	doneChan := make(chan int)
+	testcommon.VerifyTestMessageOnQueue(t, setup.Chan, "consumer", numPublishingMessages, key, doneChan)
+	assert.Equal(t, numPublishingMessages, <-doneChan)
+}
+
+func TestIntegrationAmqpPublishRejectsMessagesOfFailedTransaction(t *testing.T) {
+	setup, err := testcommon.IntegrationTestConnection("tx-exchange", "direct", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	logger := slog.New(slog.DiscardHandler)
+	publisher := NewAmqpPublish(testcommon.IntegrationURIFromEnv(), &tls.Config{}, false, false, logger).
+		WithTransactions(10)
+	publishChannel := make(PublishChannel)
+	errorChannel := make(PublishErrorChannel, 10)
+	done := make(chan error)
+
+	go func() {
+		done <- publisher.EstablishConnection(context.Background(), publishChannel, errorChannel)
+	}()
+
+	// publishing to a non-existing exchange closes the channel, which
+	// discards the open transaction
+	acks := make(chan bool, 2)
+	for _, exchange := range []string{"tx-exchange", "non-existing-exchange"} {
+		publishChannel <- &PublishMessage{
+			Routing:    NewRouting(exchange, setup.QueueName(0), amqp.Table{}),
+			Publishing: &amqp.Publishing{Body: []byte("Hello")},
+			Confirmed:  func(ok bool) { acks <- ok },
+		}
+	}
+	close(publishChannel)
+	<-done
+
+	assert.False(t, <-acks)
+	assert.False(t, <-acks)
+	assert.NotEmpty(t, errorChannel)
+}
+
+func TestIntegrationAmqpPublishDoesNotConfirmReturnedMessagesOfTransaction(t *testing.T) {
+	setup, err := testcommon.IntegrationTestConnection("tx-exchange", "direct", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	logger := slog.New(slog.DiscardHandler)
+	mandatory := true
+	publisher := NewAmqpPublish(testcommon.IntegrationURIFromEnv(), &tls.Config{}, mandatory, false, logger).
+		WithTransactions(10)
+	publishChannel := make(PublishChannel)
+	errorChannel := make(PublishErrorChannel, 10)
+	done := make(chan error)
+
+	go func() {
+		done <- publisher.EstablishConnection(context.Background(), publishChannel, errorChannel)
+	}()
+
+	// the second message can not be routed and is returned
+	acks := make([]chan bool, 2)
+	for i, key := range []string{setup.QueueName(0), "unroutable"} {
+		ack := make(chan bool, 1)
+		acks[i] = ack
+		publishChannel <- &PublishMessage{
+			Routing:    NewRouting("tx-exchange", key, amqp.Table{}),
+			Publishing: &amqp.Publishing{Body: []byte(key)},
+			Confirmed:  func(ok bool) { ack <- ok },
+		}
+	}
+	close(publishChannel)
+	require.NoError(t, <-done)
+
+	assert.True(t, <-acks[0])
+	assert.False(t, <-acks[1])
+	require.Len(t, errorChannel, 1)
+	publishErr := <-errorChannel
+	assert.Equal(t, PublishErrorReturned, publishErr.Reason)
+	require.NotNil(t, publishErr.Message)
+	assert.Equal(t, "unroutable", publishErr.Message.Routing.Key())
+}
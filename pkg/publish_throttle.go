@@ -0,0 +1,56 @@
+// track flow control of the broker while publishing
+// Copyright (C) 2026 Jan Delgado
+
+package rabtap
+
+import "time"
+
+// publishThrottle tracks whether the broker asked the publisher to pause,
+// either by blocking the connection (e.g. on a memory or disk alarm, see
+// https://www.rabbitmq.com/docs/connection-blocked) or by stopping the flow
+// of the channel.
+type publishThrottle struct {
+	blocked     bool      // connection is blocked by the broker
+	reason      string    // reason the connection was blocked for
+	flowStopped bool      // channel flow was stopped by the broker
+	since       time.Time // start of the current pause
+}
+
+// paused returns true if publishing must be paused
+func (s *publishThrottle) paused() bool {
+	return s.blocked || s.flowStopped
+}
+
+// setBlocked updates the blocked state of the connection. Returns the
+// duration of the pause if publishing is resumed, 0 otherwise.
+func (s *publishThrottle) setBlocked(blocked bool, reason string, now time.Time) time.Duration {
+	wasPaused := s.paused()
+	s.blocked, s.reason = blocked, reason
+	return s.transition(wasPaused, now)
+}
+
+// setFlow updates the flow state of the channel. Returns the duration of the
+// pause if publishing is resumed, 0 otherwise.
+func (s *publishThrottle) setFlow(active bool, now time.Time) time.Duration {
+	wasPaused := s.paused()
+	s.flowStopped = !active
+	return s.transition(wasPaused, now)
+}
+
+// cause describes why publishing is paused
+func (s *publishThrottle) cause() string {
+	if s.blocked {
+		return "connection blocked: " + s.reason
+	}
+	return "channel flow stopped"
+}
+
+func (s *publishThrottle) transition(wasPaused bool, now time.Time) time.Duration {
+	switch {
+	case !wasPaused && s.paused():
+		s.since = now
+	case wasPaused && !s.paused():
+		return now.Sub(s.since)
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package rabtap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishThrottleIsNotPausedInitially(t *testing.T) {
+	var throttle publishThrottle
+	assert.False(t, throttle.paused())
+}
+
+func TestPublishThrottleReturnsPauseDurationWhenConnectionIsUnblocked(t *testing.T) {
+	var throttle publishThrottle
+	now := time.Now()
+
+	assert.Equal(t, time.Duration(0), throttle.setBlocked(true, "low on memory", now))
+	assert.True(t, throttle.paused())
+	assert.Equal(t, "connection blocked: low on memory", throttle.cause())
+	assert.Equal(t, now, throttle.since)
+
+	assert.Equal(t, 3*time.Second, throttle.setBlocked(false, "", now.Add(3*time.Second)))
+	assert.False(t, throttle.paused())
+}
+
+func TestPublishThrottleStaysPausedUntilConnectionAndFlowAreResumed(t *testing.T) {
+	var throttle publishThrottle
+	now := time.Now()
+
+	throttle.setFlow(false, now)
+	throttle.setBlocked(true, "low on disk", now.Add(time.Second))
+	assert.Equal(t, now, throttle.since)
+
+	assert.Equal(t, "connection blocked: low on disk", throttle.cause())
+	assert.Equal(t, time.Duration(0), throttle.setFlow(true, now.Add(2*time.Second)))
+	assert.True(t, throttle.paused())
+
+	assert.Equal(t, 4*time.Second, throttle.setBlocked(false, "", now.Add(4*time.Second)))
+	assert.False(t, throttle.paused())
+}
@@ -32,6 +32,58 @@ func PurgeQueue(session Session, queueName string) (int, error) {
 	return session.QueuePurge(queueName, false /* wait*/)
 }
 
+// QueueMessageCount returns the number of messages ready for delivery in the
+// given queue
+func QueueMessageCount(session Session, queueName string) (int, error) {
+	queue, err := session.QueueDeclarePassive(queueName,
+		false, // durable, ignored in passive mode
+		false, // auto delete, ignored in passive mode
+		false, // exclusive
+		false, // wait for response
+		nil)
+	return queue.Messages, err
+}
+
+// PeekQueue takes up to count messages from the given queue using basic.get
+// and passes them to the handler. Afterwards, all messages are requeued, so
+// the queue is left unchanged, except for the redelivered flag and, on quorum
+// queues, the delivery count of the messages. Returns the number of messages
+// ready in the queue, as reported by the first basic.get.
+func PeekQueue(session Session, queueName string, count int,
+	handler func(*amqp.Delivery) error) (_ int, err error) {
+
+	var lastTag uint64
+	defer func() {
+		if lastTag == 0 {
+			return
+		}
+		// requeue all messages taken, which are still unacknowledged
+		if nackErr := session.Nack(lastTag, true, true); err == nil {
+			err = nackErr
+		}
+	}()
+
+	messageCount := 0
+	for i := 0; i < count; i++ {
+		message, ok, err := session.Get(queueName, false /* autoAck */)
+		if err != nil {
+			return messageCount, err
+		}
+		if !ok {
+			break // queue is empty
+		}
+		lastTag = message.DeliveryTag
+		if i == 0 {
+			// MessageCount does not include the message just received
+			messageCount = int(message.MessageCount) + 1
+		}
+		if err := handler(&message); err != nil {
+			return messageCount, err
+		}
+	}
+	return messageCount, nil
+}
+
 // BindQueueToExchange binds the given queue to the given exchange.
 func BindQueueToExchange(session Session,
 	queueName, key, exchangeName string, args amqp.Table) error {
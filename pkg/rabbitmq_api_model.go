@@ -366,8 +366,12 @@ type RabbitQueue struct {
 	//	Policy               interface{} `json:"policy"`
 	ConsumerUtilisation float64 `json:"consumer_utilisation"`
 	// TODO use custom marshaller and parse into time.Time
-	IdleSince string `json:"idle_since"`
-	Memory    int    `json:"memory"`
+	IdleSince    string `json:"idle_since"`
+	Memory       int    `json:"memory"`
+	MessageStats struct {
+		Publish    int `json:"publish"`
+		DeliverGet int `json:"deliver_get"`
+	} `json:"message_stats"`
 }
 
 // RabbitBinding models the /bindings resource of the rabbitmq http api
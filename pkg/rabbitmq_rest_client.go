@@ -4,6 +4,7 @@
 package rabtap
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
@@ -104,6 +105,31 @@ func (s *RabbitHTTPClient) delResource(ctx context.Context, path string) error {
 	return nil
 }
 
+// putResource make PUT request to given relative path with the given object
+// serialized as JSON body
+func (s *RabbitHTTPClient) putResource(ctx context.Context, path string, obj interface{}) error {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	url := s.url.String() + "/" + path
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ctxhttp.Do(ctx, s.client, req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != 200 && resp.StatusCode != 201 && resp.StatusCode != 204 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
 // BrokerInfo represents the state of various RabbitMQ ressources as
 // returned by the RabbitMQ REST API
 type BrokerInfo struct {
@@ -147,6 +173,13 @@ func (s *RabbitHTTPClient) Queues(ctx context.Context) ([]RabbitQueue, error) {
 	return *res.(*[]RabbitQueue), err
 }
 
+// Queue returns the /queues/vhost/name resource of the RabbitMQ REST API
+func (s *RabbitHTTPClient) Queue(ctx context.Context, vhost, name string) (RabbitQueue, error) {
+	path := "queues/" + url.PathEscape(vhost) + "/" + url.PathEscape(name)
+	res, err := s.getResource(ctx, httpRequest{path, reflect.TypeOf(RabbitQueue{})})
+	return *res.(*RabbitQueue), err
+}
+
 // Consumers returns the /consumers resource of the RabbitMQ REST API
 func (s *RabbitHTTPClient) Consumers(ctx context.Context) ([]RabbitConsumer, error) {
 	res, err := s.getResource(ctx, httpRequest{"consumers", reflect.TypeOf([]RabbitConsumer{})})
@@ -188,6 +221,24 @@ func (s *RabbitHTTPClient) CloseConnection(ctx context.Context, conn, reason str
 	return s.delResource(ctx, "connections/"+conn)
 }
 
+// DeleteExchange deletes the given exchange by DELETING the associated resource
+func (s *RabbitHTTPClient) DeleteExchange(ctx context.Context, vhost, exchange string) error {
+	return s.delResource(ctx, "exchanges/"+url.PathEscape(vhost)+"/"+url.PathEscape(exchange))
+}
+
+// DeleteQueue deletes the given queue by DELETING the associated resource
+func (s *RabbitHTTPClient) DeleteQueue(ctx context.Context, vhost, queue string) error {
+	return s.delResource(ctx, "queues/"+url.PathEscape(vhost)+"/"+url.PathEscape(queue))
+}
+
+// SetTracing enables or disables the firehose tracer on the given vhost by
+// updating the vhost resource
+func (s *RabbitHTTPClient) SetTracing(ctx context.Context, vhost string, enabled bool) error {
+	return s.putResource(ctx, "vhosts/"+url.PathEscape(vhost), struct {
+		Tracing bool `json:"tracing"`
+	}{enabled})
+}
+
 // UnmarshalJSON is a workaround to deserialize int attributes in the
 // RabbitMQ API which are sometimes returned as strings, (i.e. the
 // value "undefined").
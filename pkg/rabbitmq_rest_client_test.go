@@ -326,3 +326,73 @@ func TestRabbitClientCloseNonExistingConnectionRaisesError(t *testing.T) {
 	err := client.CloseConnection(context.TODO(), "DOES NOT EXIST", "reason")
 	assert.NotNil(t, err)
 }
+
+// test of PUT /vhosts/vhost to enable tracing
+func TestRabbitClientSetTracing(t *testing.T) {
+	mock := testcommon.NewRabbitAPIMock(testcommon.MockModeStd)
+	defer mock.Close()
+	url, _ := url.Parse(mock.URL)
+	client := NewRabbitHTTPClient(url, &tls.Config{})
+
+	err := client.SetTracing(context.TODO(), "/", true)
+	assert.Nil(t, err)
+}
+
+func TestRabbitClientSetTracingOnNonExistingVhostRaisesError(t *testing.T) {
+	mock := testcommon.NewRabbitAPIMock(testcommon.MockModeStd)
+	defer mock.Close()
+	url, _ := url.Parse(mock.URL)
+	client := NewRabbitHTTPClient(url, &tls.Config{})
+
+	err := client.SetTracing(context.TODO(), "DOES NOT EXIST", true)
+	assert.NotNil(t, err)
+}
+
+// test of GET /queues/vhost/queue to get a single queue
+func TestRabbitClientGetQueue(t *testing.T) {
+	mock := testcommon.NewRabbitAPIMock(testcommon.MockModeStd)
+	defer mock.Close()
+	url, _ := url.Parse(mock.URL)
+	client := NewRabbitHTTPClient(url, &tls.Config{})
+
+	queue, err := client.Queue(context.TODO(), "/", "tap-q1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "tap-q1", queue.Name)
+	assert.Equal(t, 10, queue.MessagesReady)
+	assert.Equal(t, 100, queue.MessageStats.Publish)
+	assert.Equal(t, 60, queue.MessageStats.DeliverGet)
+}
+
+func TestRabbitClientGetNonExistingQueueRaisesError(t *testing.T) {
+	mock := testcommon.NewRabbitAPIMock(testcommon.MockModeStd)
+	defer mock.Close()
+	url, _ := url.Parse(mock.URL)
+	client := NewRabbitHTTPClient(url, &tls.Config{})
+
+	_, err := client.Queue(context.TODO(), "/", "DOES NOT EXIST")
+
+	assert.NotNil(t, err)
+}
+
+// test of DELETE /exchanges/vhost/exchange to delete an exchange
+func TestRabbitClientDeleteExchange(t *testing.T) {
+	mock := testcommon.NewRabbitAPIMock(testcommon.MockModeStd)
+	defer mock.Close()
+	url, _ := url.Parse(mock.URL)
+	client := NewRabbitHTTPClient(url, &tls.Config{})
+
+	assert.Nil(t, client.DeleteExchange(context.TODO(), "/", "test-topic"))
+	assert.NotNil(t, client.DeleteExchange(context.TODO(), "/", "DOES NOT EXIST"))
+}
+
+// test of DELETE /queues/vhost/queue to delete a queue
+func TestRabbitClientDeleteQueue(t *testing.T) {
+	mock := testcommon.NewRabbitAPIMock(testcommon.MockModeStd)
+	defer mock.Close()
+	url, _ := url.Parse(mock.URL)
+	client := NewRabbitHTTPClient(url, &tls.Config{})
+
+	assert.Nil(t, client.DeleteQueue(context.TODO(), "/", "direct-q2"))
+	assert.NotNil(t, client.DeleteQueue(context.TODO(), "/", "DOES NOT EXIST"))
+}
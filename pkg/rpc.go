@@ -0,0 +1,115 @@
+// request/reply using direct reply-to
+// (see https://www.rabbitmq.com/docs/direct-reply-to)
+// Copyright (C) 2026 Jan Delgado
+
+package rabtap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"uuid"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DirectReplyTo is the pseudo queue used to receive replies without
+// declaring a reply queue
+const DirectReplyTo = "amq.rabbitmq.reply-to"
+
+// ErrReplyTimeout is returned by Call when no reply was received in time
+var ErrReplyTimeout = errors.New("timeout waiting for reply")
+
+// RPCConfig stores the configuration of a request/reply call
+type RPCConfig struct {
+	// TempReplyQueue receives the reply on a temporary, exclusive queue
+	// instead of the direct reply-to pseudo queue
+	TempReplyQueue bool
+	// Timeout is the maximum duration to wait for the reply
+	Timeout time.Duration
+}
+
+// Call publishes the request with the given routing and waits for the
+// reply. The request is published with ReplyTo set to the reply queue and
+// a generated CorrelationId, if not already set. Replies with a different
+// correlation id are ignored. Since direct reply-to requires the reply
+// consumer and the publisher to share a channel, both use the channel of
+// the given session. Returns ErrReplyTimeout if no reply was received
+// within the configured timeout.
+func Call(ctx context.Context, session Session, config RPCConfig,
+	routing Routing, request amqp.Publishing,
+) (*amqp.Delivery, error) {
+	replyTo := DirectReplyTo
+	if config.TempReplyQueue {
+		queue, err := session.QueueDeclare("", // server-named
+			false, // durable
+			true,  // auto delete
+			true,  // exclusive
+			false, // wait for response
+			nil)
+		if err != nil {
+			return nil, fmt.Errorf("declare reply queue: %w", err)
+		}
+		replyTo = queue.Name
+	}
+
+	errorCh := session.Channel.NotifyClose(make(chan *amqp.Error, 1))
+	returns := session.NotifyReturn(make(chan amqp.Return, 1))
+
+	// direct reply-to requires to consume in no-ack mode before publishing
+	replies, err := session.Consume(replyTo,
+		"__rabtap-rpc-"+uuid.New().String()[:8],
+		true,  // auto-ack
+		true,  // exclusive
+		false, // no-local - unsupported
+		false, // wait
+		nil)
+	if err != nil {
+		return nil, fmt.Errorf("consume replies: %w", err)
+	}
+
+	if request.CorrelationId == "" {
+		request.CorrelationId = uuid.New().String()
+	}
+	request.ReplyTo = replyTo
+	request.Headers = EnsureAMQPTable(routing.Headers()).(amqp.Table)
+	err = session.PublishWithContext(ctx,
+		routing.Exchange(),
+		routing.Key(),
+		true,  // mandatory, so unroutable requests fail immediately
+		false, // immediate
+		request)
+	if err != nil {
+		return nil, fmt.Errorf("publish request: %w", err)
+	}
+
+	timeout := time.NewTimer(config.Timeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case reply, more := <-replies:
+			if !more {
+				// the channel was closed, e.g. publishing to a non-existing exchange
+				select {
+				case err := <-errorCh:
+					return nil, fmt.Errorf("channel error: %w", err)
+				default:
+					return nil, errors.New("reply consumer was closed")
+				}
+			}
+			if reply.CorrelationId == request.CorrelationId {
+				return &reply, nil
+			}
+		case returned := <-returns:
+			return nil, fmt.Errorf("server returned request for %s: %s",
+				routing, returned.ReplyText)
+		case err := <-errorCh:
+			return nil, fmt.Errorf("channel error: %w", err)
+		case <-timeout.C:
+			return nil, ErrReplyTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2026 Jan Delgado
+//go:build integration
+
+package rabtap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jandelgado/rabtap/pkg/testcommon"
+)
+
+// respondOnce replies to the first request received on the given queue by
+// echoing the upper-cased body
+func respondOnce(t *testing.T, ch *amqp.Channel, queue string) {
+	requests, err := ch.Consume(queue, "", true, false, false, false, nil)
+	require.NoError(t, err)
+	go func() {
+		request := <-requests
+		err := ch.Publish("", request.ReplyTo, false, false, amqp.Publishing{
+			CorrelationId: request.CorrelationId,
+			Body:          append([]byte("re: "), request.Body...),
+		})
+		assert.NoError(t, err)
+	}()
+}
+
+func TestIntegrationCallReceivesReply(t *testing.T) {
+	for _, tempQueue := range []bool{false, true} {
+		setup, err := testcommon.IntegrationTestConnection("rpc-exchange", "direct", 1, false)
+		require.NoError(t, err)
+		defer func() { _ = setup.Conn.Close() }()
+		respondOnce(t, setup.Chan, setup.QueueName(0))
+
+		conn, ch, err := openAMQPChannel(testcommon.IntegrationURIFromEnv(), nil)
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+
+		reply, err := Call(context.Background(), Session{conn, ch},
+			RPCConfig{TempReplyQueue: tempQueue, Timeout: 5 * time.Second},
+			NewRouting("rpc-exchange", setup.QueueName(0), amqp.Table{}),
+			amqp.Publishing{CorrelationId: "42", Body: []byte("hello")})
+
+		require.NoError(t, err)
+		assert.Equal(t, "42", reply.CorrelationId)
+		assert.Equal(t, []byte("re: hello"), reply.Body)
+	}
+}
+
+func TestIntegrationCallTimesOutWithoutResponder(t *testing.T) {
+	setup, err := testcommon.IntegrationTestConnection("rpc-exchange", "direct", 1, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	_, err = Call(context.Background(), Session{setup.Conn, setup.Chan},
+		RPCConfig{Timeout: 100 * time.Millisecond},
+		NewRouting("rpc-exchange", setup.QueueName(0), amqp.Table{}),
+		amqp.Publishing{Body: []byte("hello")})
+
+	assert.ErrorIs(t, err, ErrReplyTimeout)
+}
+
+func TestIntegrationCallFailsWhenRequestIsUnroutable(t *testing.T) {
+	setup, err := testcommon.IntegrationTestConnection("", "", 0, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	_, err = Call(context.Background(), Session{setup.Conn, setup.Chan},
+		RPCConfig{Timeout: 5 * time.Second},
+		NewRouting("", "rpc-queue-does-not-exist", amqp.Table{}),
+		amqp.Publishing{Body: []byte("hello")})
+
+	assert.ErrorContains(t, err, "NO_ROUTE")
+}
@@ -18,12 +18,18 @@ import (
 const (
 	PrefetchCount = 1
 	PrefetchSize  = 0
+	// PrefetchUnlimited disables the limit of unacknowledged messages
+	PrefetchUnlimited = -1
 )
 
 // AmqpSubscriberConfig stores configuration of the subscriber
 type AmqpSubscriberConfig struct {
 	Exclusive bool
 	Args      amqp.Table
+	// PrefetchCount is the number of unacknowledged messages the broker
+	// delivers to the subscriber. Defaults to PrefetchCount, use
+	// PrefetchUnlimited to remove the limit.
+	PrefetchCount int
 }
 
 // AmqpSubscriber allows to tap to subscribe to queues
@@ -72,6 +78,35 @@ func NewAmqpSubscriber(config AmqpSubscriberConfig, url *url.URL, tlsConfig *tls
 type TapMessage struct {
 	AmqpMessage       *amqp.Delivery
 	ReceivedTimestamp time.Time
+	Trace             *TraceInfo // set on messages decoded from the FireHose
+	Source            *TapSource // set on messages received by a tap
+	Paths             int        // number of taps the message was received by, set by DeduplicateMessages
+}
+
+// TapSource identifies the tap a message was received by
+type TapSource struct {
+	BrokerURL  string // URL of the broker, with the password redacted
+	Exchange   string // the tapped exchange
+	BindingKey string // the binding key of the tap
+}
+
+// sourcedDelivery is a delivery received by a tap, along with its source
+type sourcedDelivery struct {
+	delivery amqp.Delivery
+	source   *TapSource
+}
+
+// wrapChanWithSource works like WrapChan, but passes each delivery received
+// on c along with the given source
+func wrapChanWithSource(c <-chan amqp.Delivery, source *TapSource) <-chan interface{} {
+	wrapped := make(chan interface{})
+	go func() {
+		for m := range c {
+			wrapped <- sourcedDelivery{m, source}
+		}
+		close(wrapped)
+	}()
+	return wrapped
 }
 
 // NewTapMessage constructs a new TapMessage
@@ -118,7 +153,14 @@ func (s *AmqpSubscriber) createWorkerFunc(
 func (s *AmqpSubscriber) consumeMessages(session Session,
 	queueName string,
 ) (<-chan amqp.Delivery, error) {
-	err := session.Qos(PrefetchCount, PrefetchSize, false)
+	prefetchCount := s.config.PrefetchCount
+	switch {
+	case prefetchCount == PrefetchUnlimited:
+		prefetchCount = 0
+	case prefetchCount <= 0:
+		prefetchCount = PrefetchCount
+	}
+	err := session.Qos(prefetchCount, PrefetchSize, false)
 	if err != nil {
 		return nil, err
 	}
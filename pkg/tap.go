@@ -7,35 +7,198 @@ package rabtap
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
 	"uuid"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+const (
+	// DefaultTapNamePrefix is the default prefix of tap exchanges and queues
+	DefaultTapNamePrefix = "__tap-"
+	// DefaultTapNameTemplate is the default template of the names of tap
+	// exchanges and queues
+	DefaultTapNameTemplate = "{{.Prefix}}{{.Kind}}-for-{{.Exchange}}-{{.ID}}"
+)
+
+// AmqpTapConfig stores the configuration of the tap
+type AmqpTapConfig struct {
+	// NamePrefix is the prefix of the names of the tap exchanges and queues.
+	// Defaults to DefaultTapNamePrefix.
+	NamePrefix string
+	// NameTemplate is the template used to name tap exchanges and queues.
+	// Available fields are .Prefix, .Kind ("exchange" or "queue"), .Exchange
+	// (the tapped exchange) and .ID (a unique id). Defaults to
+	// DefaultTapNameTemplate.
+	NameTemplate string
+	// Queue is an optional pre-provisioned queue to tap through. If set, no
+	// tap exchanges and queues are created. Instead the tapped exchanges are
+	// bound to the queue and the bindings are removed when the tap ends.
+	Queue string
+	// MaxLength optionally limits the number of messages in a tap queue. When
+	// the limit is reached, messages are dropped from the head of the queue.
+	MaxLength int64
+	// MaxLengthBytes optionally limits the total size of the message bodies
+	// in a tap queue. When reached, messages are dropped from the head.
+	MaxLengthBytes int64
+	// MessageTTL optionally sets the time after which messages in a tap
+	// queue expire.
+	MessageTTL time.Duration
+	// OnTeardown is optionally called with the names of the tap queues of a
+	// session, before the tap ends and the queues are removed, e.g. to
+	// collect queue statistics.
+	OnTeardown func(queues []string)
+}
+
+// IsBounded returns true if the tap queues are bounded by a length limit or
+// a message TTL, i.e. messages may be dropped
+func (s AmqpTapConfig) IsBounded() bool {
+	return s.MaxLength > 0 || s.MaxLengthBytes > 0 || s.MessageTTL > 0
+}
+
+// queueArgs returns the arguments to declare tap queues with
+func (s AmqpTapConfig) queueArgs() amqp.Table {
+	args := amqp.Table{}
+	if s.MaxLength > 0 {
+		args["x-max-length"] = s.MaxLength
+	}
+	if s.MaxLengthBytes > 0 {
+		args["x-max-length-bytes"] = s.MaxLengthBytes
+	}
+	if s.MaxLength > 0 || s.MaxLengthBytes > 0 {
+		args["x-overflow"] = "drop-head"
+	}
+	if s.MessageTTL > 0 {
+		args["x-message-ttl"] = s.MessageTTL.Milliseconds()
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// tapNameEnv holds the fields available in the tap name template
+type tapNameEnv struct {
+	Prefix   string
+	Kind     string
+	Exchange string
+	ID       string
+}
+
+// placeholders the tap name template is rendered with to find the positions
+// of the fields in the resulting names
+const prefixMark, exchangeMark, idMark = "\x00p\x00", "\x00e\x00", "\x00i\x00"
+
+// tapIDLength is the length of the unique id in the names of tap exchanges
+// and queues, which is a prefix of a UUID
+const tapIDLength = 12
+
+// renderTapName renders the tap name template with the given prefix and
+// fields, applying the defaults.
+func (s AmqpTapConfig) renderTapName(prefix, kind, exchange, id string) (string, error) {
+	tmpl := s.NameTemplate
+	if tmpl == "" {
+		tmpl = DefaultTapNameTemplate
+	}
+	t, err := template.New("name").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid tap name template: %w", err)
+	}
+	var name strings.Builder
+	if err := t.Execute(&name, tapNameEnv{prefix, kind, exchange, id}); err != nil {
+		return "", fmt.Errorf("invalid tap name template: %w", err)
+	}
+	return name.String(), nil
+}
+
+func (s AmqpTapConfig) namePrefix() string {
+	if s.NamePrefix == "" {
+		return DefaultTapNamePrefix
+	}
+	return s.NamePrefix
+}
+
+// tapName returns the name of the tap exchange or queue (depending on kind)
+// for the given exchange.
+func (s AmqpTapConfig) tapName(kind, exchange, id string) (string, error) {
+	return s.renderTapName(s.namePrefix(), kind, exchange, id)
+}
+
+// TapNamePattern returns a regular expression matching the names of the tap
+// exchanges or queues (depending on kind) created with the configuration,
+// e.g. to find orphaned tap resources. To not match unrelated names, the
+// name template must contain the .Prefix field. The first occurrence of the
+// .ID field is captured by the group named "id".
+func (s AmqpTapConfig) TapNamePattern(kind string) (*regexp.Regexp, error) {
+	// render the template with placeholders, which are then replaced by
+	// the patterns of the fields
+	name, err := s.renderTapName(prefixMark, kind, exchangeMark, idMark)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(name, prefixMark) {
+		return nil, errors.New("tap name template does not contain the .Prefix field")
+	}
+	idPattern := fmt.Sprintf("[0-9a-f-]{%d}", tapIDLength)
+	pattern := strings.Replace(regexp.QuoteMeta(name), idMark, "(?P<id>"+idPattern+")", 1)
+	pattern = strings.NewReplacer(
+		prefixMark, regexp.QuoteMeta(s.namePrefix()),
+		exchangeMark, ".*",
+		idMark, idPattern,
+	).Replace(pattern)
+	return regexp.Compile("^" + pattern + "$")
+}
+
+// Validate checks the tap name template of the configuration. The template
+// must contain the .ID field, so that concurrent taps do not share names, and
+// the .Exchange field, so that the taps of different exchanges do not share
+// names.
+func (s AmqpTapConfig) Validate() error {
+	name, err := s.renderTapName(prefixMark, "exchange", exchangeMark, idMark)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(name, idMark) {
+		return errors.New("tap name template does not contain the .ID field")
+	}
+	if !strings.Contains(name, exchangeMark) {
+		return errors.New("tap name template does not contain the .Exchange field")
+	}
+	return nil
+}
+
 // AmqpTap allows to tap to an RabbitMQ exchange.
 type AmqpTap struct {
 	*AmqpSubscriber
-	exchanges []string // list of tap-exchanges created
-	queues    []string // list of tap-queues created
+	tapConfig AmqpTapConfig
+	exchanges []string                // list of tap-exchanges created
+	queues    []string                // list of tap-queues created
+	bindings  []ExchangeConfiguration // bindings to the pre-provisioned queue
 }
 
 // NewAmqpTap returns a new AmqpTap object associated with the RabbitMQ
 // broker denoted by the uri parameter.
-func NewAmqpTap(url *url.URL, tlsConfig *tls.Config, logger *slog.Logger) *AmqpTap {
+func NewAmqpTap(tapConfig AmqpTapConfig, url *url.URL, tlsConfig *tls.Config, logger *slog.Logger) *AmqpTap {
 	config := AmqpSubscriberConfig{Exclusive: true}
 	return &AmqpTap{
 		AmqpSubscriber: NewAmqpSubscriber(config, url, tlsConfig, logger),
+		tapConfig:      tapConfig,
 	}
 }
 
-func getTapExchangeNameForExchange(exchange, postfix string) string {
-	return "__tap-exchange-for-" + exchange + "-" + postfix
+func (s *AmqpTap) getTapExchangeNameForExchange(exchange, postfix string) (string, error) {
+	return s.tapConfig.tapName("exchange", exchange, postfix)
 }
 
-func getTapQueueNameForExchange(exchange, postfix string) string {
-	return "__tap-queue-for-" + exchange + "-" + postfix
+func (s *AmqpTap) getTapQueueNameForExchange(exchange, postfix string) (string, error) {
+	return s.tapConfig.tapName("queue", exchange, postfix)
 }
 
 // EstablishTap sets up the connection to the broker and sets up
@@ -56,7 +219,16 @@ func (s *AmqpTap) createWorkerFunc(
 	errOutCh SubscribeErrorChannel,
 ) AmqpWorkerFunc {
 	return func(ctx context.Context, session Session) (ReconnectAction, error) {
-		tappedChs, err := s.setupTapsForExchanges(session, exchangeConfigList)
+		var tappedChs []<-chan interface{}
+		var err error
+		if s.tapConfig.Queue != "" {
+			tappedChs, err = s.setupTapsWithQueue(session, exchangeConfigList)
+			defer s.removeBindingsFromQueue(session)
+		} else {
+			// tap exchanges and queues of a prior session are gone
+			s.exchanges, s.queues = nil, nil
+			tappedChs, err = s.setupTapsForExchanges(session, exchangeConfigList)
+		}
 		if err != nil {
 			return doNotReconnect, err
 		}
@@ -65,20 +237,32 @@ func (s *AmqpTap) createWorkerFunc(
 		amqpErrorCh := session.Channel.NotifyClose(make(chan *amqp.Error, 1))
 
 		chans := []<-chan interface{}{WrapChan(amqpErrorCh)}
-		for _, c := range tappedChs {
-			chans = append(chans, WrapChan(c))
-		}
+		chans = append(chans, tappedChs...)
 
 		fanin := Fanin(ctx, chans)
-		return amqpMessageLoop(ctx, outCh, errOutCh, fanin)
+		action, err := amqpMessageLoop(ctx, outCh, errOutCh, fanin)
+		if !action.shouldReconnect() && s.tapConfig.OnTeardown != nil && len(s.queues) > 0 {
+			s.tapConfig.OnTeardown(s.queues)
+		}
+		return action, err
+	}
+}
+
+// tapSource returns the source of messages received by the tap of the given
+// exchange
+func (s *AmqpTap) tapSource(exchangeConfig ExchangeConfiguration) *TapSource {
+	return &TapSource{
+		BrokerURL:  s.connection.url.Redacted(),
+		Exchange:   exchangeConfig.Exchange,
+		BindingKey: exchangeConfig.BindingKey,
 	}
 }
 
 func (s *AmqpTap) setupTapsForExchanges(
 	session Session,
 	exchangeConfigList []ExchangeConfiguration,
-) ([]<-chan amqp.Delivery, error) {
-	var channels []<-chan amqp.Delivery
+) ([]<-chan interface{}, error) {
+	var channels []<-chan interface{}
 
 	for _, exchangeConfig := range exchangeConfigList {
 		exchange, queue, err := s.setupTap(session, exchangeConfig)
@@ -89,7 +273,7 @@ func (s *AmqpTap) setupTapsForExchanges(
 		if err != nil {
 			return channels, err
 		}
-		channels = append(channels, msgCh)
+		channels = append(channels, wrapChanWithSource(msgCh, s.tapSource(exchangeConfig)))
 		// store created exchanges and queues for later cleanup
 		s.exchanges = append(s.exchanges, exchange)
 		s.queues = append(s.queues, queue)
@@ -97,6 +281,50 @@ func (s *AmqpTap) setupTapsForExchanges(
 	return channels, nil
 }
 
+// setupTapsWithQueue binds the exchanges to the pre-provisioned queue and
+// consumes the queue. No exchanges and queues are created. Since all tapped
+// exchanges share the queue, the tapped exchange is only part of the source
+// of the received messages, when a single exchange is tapped.
+func (s *AmqpTap) setupTapsWithQueue(
+	session Session,
+	exchangeConfigList []ExchangeConfiguration,
+) ([]<-chan interface{}, error) {
+	queue := s.tapConfig.Queue
+	for _, exchangeConfig := range exchangeConfigList {
+		err := BindQueueToExchange(session, queue, exchangeConfig.BindingKey,
+			exchangeConfig.Exchange, ToAMQPTable(exchangeConfig.BindingArgs))
+		if err != nil {
+			return nil, err
+		}
+		// store bindings for later cleanup
+		s.bindings = append(s.bindings, exchangeConfig)
+	}
+	msgCh, err := s.consumeMessages(session, queue)
+	if err != nil {
+		return nil, err
+	}
+	source := &TapSource{BrokerURL: s.connection.url.Redacted()}
+	if len(exchangeConfigList) == 1 {
+		source = s.tapSource(exchangeConfigList[0])
+	}
+	return []<-chan interface{}{wrapChanWithSource(msgCh, source)}, nil
+}
+
+// removeBindingsFromQueue removes the bindings created by setupTapsWithQueue
+// from the pre-provisioned queue.
+func (s *AmqpTap) removeBindingsFromQueue(session Session) {
+	queue := s.tapConfig.Queue
+	for _, exchangeConfig := range s.bindings {
+		err := UnbindQueueFromExchange(session, queue, exchangeConfig.BindingKey,
+			exchangeConfig.Exchange, ToAMQPTable(exchangeConfig.BindingArgs))
+		if err != nil {
+			s.logger.Error("failed to remove binding", "queue", queue,
+				"exchange", exchangeConfig.Exchange, "error", err)
+		}
+	}
+	s.bindings = nil
+}
+
 // setupTap sets up the a single tap to an exchange.  We create an
 // exchange-to-exchange binding where the bound exchange (of type fanout) will
 // receive all messages published to the original exchange. Returns
@@ -105,12 +333,19 @@ func (s *AmqpTap) setupTap(session Session,
 	exchangeConfig ExchangeConfiguration,
 ) (string, string, error) {
 	id := uuid.New().String()
-	tapExchange := getTapExchangeNameForExchange(exchangeConfig.Exchange, id[:12])
-	tapQueue := getTapQueueNameForExchange(exchangeConfig.Exchange, id[:12])
+	tapExchange, err := s.getTapExchangeNameForExchange(exchangeConfig.Exchange, id[:tapIDLength])
+	if err != nil {
+		return "", "", err
+	}
+	tapQueue, err := s.getTapQueueNameForExchange(exchangeConfig.Exchange, id[:tapIDLength])
+	if err != nil {
+		return "", "", err
+	}
 
-	err := s.createExchangeToExchangeBinding(session,
+	err = s.createExchangeToExchangeBinding(session,
 		exchangeConfig.Exchange,
 		exchangeConfig.BindingKey,
+		ToAMQPTable(exchangeConfig.BindingArgs),
 		tapExchange)
 	if err != nil {
 		return "", "", err
@@ -120,7 +355,7 @@ func (s *AmqpTap) setupTap(session Session,
 		false, // non durable
 		true,  // auto delete
 		true,  // exclusive
-		nil)
+		s.tapConfig.queueArgs())
 	if err != nil {
 		return "", "", err
 	}
@@ -141,11 +376,13 @@ func (s *AmqpTap) setupTap(session Session,
 // - '#' on topic exchanges
 // - a binding-key on direct exchanges (i.e. no wildcards)
 // - ” on fanout or headers exchanges
+// On headers exchanges, the header matches (including x-match) are passed
+// in the binding arguments args.
 // On errors delete prior created exchanges and/or queues to make sure
 // that there are no leftovers lying around on the broker.
 // TODO error handling must be improved - does not work if connection is lost
 func (s *AmqpTap) createExchangeToExchangeBinding(session Session,
-	exchangeName, bindingKey, tapExchangeName string,
+	exchangeName, bindingKey string, args amqp.Table, tapExchangeName string,
 ) error {
 	var err error
 
@@ -154,15 +391,12 @@ func (s *AmqpTap) createExchangeToExchangeBinding(session Session,
 		return err
 	}
 
-	// TODO when tapping to headers exchange the bindingKey must be
-	// "translated" into an amqp.Table{} struct. Right know we are always
-	// seeing all messages sent to exchanges of type headers.
 	if err = session.ExchangeBind(
 		tapExchangeName, // destination
 		bindingKey,
 		exchangeName, // source
 		false,        // wait for response
-		amqp.Table{}); err != nil {
+		args); err != nil {
 
 		// bind failed, so we must also delete our tap-exchange since it
 		// will not be auto-deleted when no binding exists.
@@ -15,8 +15,19 @@ type ExchangeConfiguration struct {
 	// BindingKey is the binding key to use. The key depends on the the type
 	// of exchange being tapped (e.g. direct, topic).
 	BindingKey string
+	// BindingArgs are optional arguments used for the exchange-to-exchange
+	// binding, e.g. the header matches when tapping a headers exchange.
+	BindingArgs KeyValueMap
+	// DiscoverBindings is set when no binding key was given. The binding keys
+	// are then discovered using the management API (see discovery.go)
+	DiscoverBindings bool
 }
 
+// headerMatchKey is the binding argument selecting the match mode of a
+// header based binding. A binding starting with "x-match=" is interpreted as
+// a list of header matches, e.g. "x-match=all,tenant=acme"
+const headerMatchKey = "x-match"
+
 // unescapeStr reutrns a string with all '\' characters removed from the
 // given string
 func unescapeStr(s string) string {
@@ -33,6 +44,22 @@ func unescapeStr(s string) string {
 	return res
 }
 
+// splitUnescaped splits the given string at each occurence of sep, which is
+// not escaped by a '\'. The escape characters are kept in the result.
+func splitUnescaped(s string, sep rune) []string {
+	var res []string
+	inEscape := false
+	start := 0
+	for i, c := range s {
+		if c == sep && !inEscape {
+			res = append(res, s[start:i])
+			start = i + 1
+		}
+		inEscape = (c == '\\' && !inEscape)
+	}
+	return append(res, s[start:])
+}
+
 // splitExchangeAndBinding splits a string of the form "exchange:binding"
 // and return exchange and binding as string. A colon can be escaped with
 // \: if it is part of the exchange or binding string, e.g.
@@ -54,14 +81,88 @@ func splitExchangeAndBinding(exchangeAndBinding string) (string, string, error)
 	return unescapeStr(exchangeAndBinding[:pos]), unescapeStr(exchangeAndBinding[pos+1:]), nil
 }
 
+// parseHeaderMatch parses a single header match of the form "key=value"
+func parseHeaderMatch(s string) (string, string, error) {
+	key, value, found := strings.Cut(s, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !found || key == "" {
+		return "", "", errors.New("expected header match of form `key=value`, but got `" + s + "`")
+	}
+	return key, value, nil
+}
+
+// isHeaderMatchContinuation returns true if the given item of a list of
+// exchanges and bindings is of the form "key=value", i.e. if an unescaped '='
+// occurs before the first unescaped ':'. The value of a header match may thus
+// contain colons, e.g. "time=12:00", while an exchange name containing a '='
+// must be escaped when following a header match, e.g. "ex\=change:binding".
+func isHeaderMatchContinuation(item string) bool {
+	inEscape := false
+	for _, c := range item {
+		if !inEscape {
+			switch c {
+			case '=':
+				return true
+			case ':':
+				return false
+			}
+		}
+		inEscape = (c == '\\' && !inEscape)
+	}
+	return false
+}
+
+// isHeaderMatch returns true if the given binding is a list of header matches,
+// which is the case when the binding starts with the x-match argument.
+func isHeaderMatch(binding string) bool {
+	return strings.HasPrefix(strings.TrimSpace(binding), headerMatchKey+"=")
+}
+
+// addHeaderMatch adds the header match given as "key=value" to the binding
+// arguments of the exchange configuration.
+func (s *ExchangeConfiguration) addHeaderMatch(match string) error {
+	key, value, err := parseHeaderMatch(match)
+	if err != nil {
+		return err
+	}
+	if key == headerMatchKey {
+		switch value {
+		case "all", "any", "all-with-x", "any-with-x":
+		default:
+			return errors.New("x-match must be one of {all, any, all-with-x, any-with-x}, but got `" + value + "`")
+		}
+	}
+	s.BindingArgs[key] = value
+	return nil
+}
+
 // NewExchangeConfiguration returns a pointer to a newly created
-// ExchangeConfiguration object
+// ExchangeConfiguration object. When the binding is a list of header
+// matches starting with x-match (e.g. "exchange:x-match=any,tenant=acme"),
+// the header matches are stored in BindingArgs and the binding key is empty.
+// When no binding is given at all (e.g. "exchange"), the bindings must be
+// discovered later, which is signaled by the DiscoverBindings flag.
 func NewExchangeConfiguration(exchangeAndBindingStr string) (*ExchangeConfiguration, error) {
+	if len(splitUnescaped(exchangeAndBindingStr, ':')) == 1 {
+		return &ExchangeConfiguration{
+			Exchange:         unescapeStr(exchangeAndBindingStr),
+			DiscoverBindings: true,
+		}, nil
+	}
 	exchange, binding, err := splitExchangeAndBinding(exchangeAndBindingStr)
 	if err != nil {
 		return nil, err
 	}
-	return &ExchangeConfiguration{exchange, binding}, nil
+	if !isHeaderMatch(binding) {
+		return &ExchangeConfiguration{Exchange: exchange, BindingKey: binding}, nil
+	}
+	config := &ExchangeConfiguration{Exchange: exchange, BindingArgs: KeyValueMap{}}
+	for _, match := range strings.Split(binding, ",") {
+		if err := config.addHeaderMatch(match); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
 }
 
 // TapConfiguration holds the set of ExchangeCOnfigurations to tap to for a
@@ -73,12 +174,25 @@ type TapConfiguration struct {
 
 // NewTapConfiguration returns a TapConfiguration object for a an rabbitMQ
 // broker specified by an URI and a list of exchanges and bindings in the
-// form of "exchange:binding,exchange:binding). Returns configuration object
-// or an error if parsing failed.
+// form of "exchange:binding,exchange:binding). The binding is optional. Header matches of a headers
+// exchange continue the list after the x-match argument, e.g.
+// "exchange:x-match=all,tenant=acme,region=eu,other:binding". An item is
+// a header match if it contains a '=' before any ':' (see
+// isHeaderMatchContinuation), so header values may contain colons. Returns
+// configuration object or an error if parsing failed.
 func NewTapConfiguration(amqpURL *url.URL, exchangesAndBindings string) (*TapConfiguration, error) {
 	result := TapConfiguration{}
 	result.AMQPURL = amqpURL
-	for _, item := range strings.Split(exchangesAndBindings, ",") {
+	for _, item := range splitUnescaped(exchangesAndBindings, ',') {
+		// a "key=value" item following a header match is a further header
+		// match of the previous exchange
+		if n := len(result.Exchanges); n > 0 && result.Exchanges[n-1].BindingArgs != nil &&
+			isHeaderMatchContinuation(item) {
+			if err := result.Exchanges[n-1].addHeaderMatch(unescapeStr(item)); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		exchangeConfig, err := NewExchangeConfiguration(item)
 		if err != nil {
 			return nil, err
@@ -87,3 +201,14 @@ func NewTapConfiguration(amqpURL *url.URL, exchangesAndBindings string) (*TapCon
 	}
 	return &result, nil
 }
+
+// NeedsBindingDiscovery returns true if any of the exchanges to tap has no
+// binding key set, which must then be discovered.
+func (s TapConfiguration) NeedsBindingDiscovery() bool {
+	for _, config := range s.Exchanges {
+		if config.DiscoverBindings {
+			return true
+		}
+	}
+	return false
+}
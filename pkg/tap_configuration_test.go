@@ -53,7 +53,97 @@ func TestNewTapConfigurationIsConstructedCorrecly(t *testing.T) {
 func TestFaultyTapConfiguration(t *testing.T) {
 
 	url, _ := url.Parse("uri")
-	_, err := NewTapConfiguration(url, "exchange")
+	_, err := NewTapConfiguration(url, "exchange:x-match=invalid")
+
+	assert.NotNil(t, err)
+}
+
+func TestNewTapConfigurationWithoutBindingKeyRequestsDiscovery(t *testing.T) {
+	url, _ := url.Parse("uri")
+	tc, err := NewTapConfiguration(url, "e1,e2:b2,e\\:3")
+
+	assert.Nil(t, err)
+	assert.True(t, tc.NeedsBindingDiscovery())
+	assert.Equal(t, 3, len(tc.Exchanges))
+	assert.Equal(t, ExchangeConfiguration{Exchange: "e1", DiscoverBindings: true}, tc.Exchanges[0])
+	assert.Equal(t, ExchangeConfiguration{Exchange: "e2", BindingKey: "b2"}, tc.Exchanges[1])
+	assert.Equal(t, ExchangeConfiguration{Exchange: "e:3", DiscoverBindings: true}, tc.Exchanges[2])
+}
+
+func TestNewTapConfigurationWithBindingKeysNeedsNoDiscovery(t *testing.T) {
+	url, _ := url.Parse("uri")
+	tc, err := NewTapConfiguration(url, "e1:,e2:b2")
+
+	assert.Nil(t, err)
+	assert.False(t, tc.NeedsBindingDiscovery())
+}
+
+func TestSplitUnescapedHonorsEscapedSeparators(t *testing.T) {
+	assert.Equal(t, []string{""}, splitUnescaped("", ','))
+	assert.Equal(t, []string{"a", "b"}, splitUnescaped("a,b", ','))
+	assert.Equal(t, []string{"a\\,b", "c"}, splitUnescaped("a\\,b,c", ','))
+	assert.Equal(t, []string{"a\\\\", "b"}, splitUnescaped("a\\\\,b", ','))
+}
+
+func TestNewExchangeConfigurationParsesHeaderMatches(t *testing.T) {
+	ec, err := NewExchangeConfiguration("headers:x-match=any,tenant=acme")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "headers", ec.Exchange)
+	assert.Equal(t, "", ec.BindingKey)
+	assert.Equal(t, KeyValueMap{"x-match": "any", "tenant": "acme"}, ec.BindingArgs)
+}
+
+func TestNewExchangeConfigurationWithoutHeaderMatchHasNoBindingArgs(t *testing.T) {
+	ec, err := NewExchangeConfiguration("topic:tenant=acme")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "tenant=acme", ec.BindingKey)
+	assert.Nil(t, ec.BindingArgs)
+}
+
+func TestNewExchangeConfigurationRaisesErrorOnInvalidXMatch(t *testing.T) {
+	_, err := NewExchangeConfiguration("headers:x-match=some")
+	assert.NotNil(t, err)
+}
+
+func TestNewTapConfigurationWithHeaderMatchesIsConstructedCorrectly(t *testing.T) {
+	url, _ := url.Parse("uri")
+	tc, err := NewTapConfiguration(url, "e1:x-match=all,tenant=acme,region=eu,e2:b2")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tc.Exchanges))
+	assert.Equal(t, "e1", tc.Exchanges[0].Exchange)
+	assert.Equal(t, "", tc.Exchanges[0].BindingKey)
+	assert.Equal(t, KeyValueMap{"x-match": "all", "tenant": "acme", "region": "eu"},
+		tc.Exchanges[0].BindingArgs)
+	assert.Equal(t, "e2", tc.Exchanges[1].Exchange)
+	assert.Equal(t, "b2", tc.Exchanges[1].BindingKey)
+	assert.Nil(t, tc.Exchanges[1].BindingArgs)
+}
+
+func TestNewTapConfigurationAllowsColonsInHeaderMatchValues(t *testing.T) {
+	url, _ := url.Parse("uri")
+	tc, err := NewTapConfiguration(url, "e1:x-match=all,x=a:b,e\\=2:b2")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tc.Exchanges))
+	assert.Equal(t, KeyValueMap{"x-match": "all", "x": "a:b"}, tc.Exchanges[0].BindingArgs)
+	assert.Equal(t, "e=2", tc.Exchanges[1].Exchange)
+	assert.Equal(t, "b2", tc.Exchanges[1].BindingKey)
+}
+
+func TestIsHeaderMatchContinuation(t *testing.T) {
+	assert.True(t, isHeaderMatchContinuation("tenant=acme"))
+	assert.True(t, isHeaderMatchContinuation("time=12:00"))
+	assert.False(t, isHeaderMatchContinuation("exchange:key=value"))
+	assert.False(t, isHeaderMatchContinuation("ex\\=change:key"))
+	assert.False(t, isHeaderMatchContinuation("exchange"))
+}
+
+func TestNewTapConfigurationRaisesErrorOnInvalidHeaderMatch(t *testing.T) {
+	url, _ := url.Parse("uri")
+	_, err := NewTapConfiguration(url, "e1:x-match=all,=acme")
 
 	assert.NotNil(t, err)
 }
@@ -14,6 +14,7 @@ import (
 	"context"
 	"crypto/tls"
 	"log/slog"
+	"strings"
 	"testing"
 	"time"
 	"uuid"
@@ -30,21 +31,109 @@ const (
 )
 
 func TestGetTapQueueNameForExchange(t *testing.T) {
-	assert.Equal(t, "__tap-queue-for-exchange-1234",
-		getTapQueueNameForExchange("exchange", "1234"))
+	tap := NewAmqpTap(AmqpTapConfig{}, testcommon.IntegrationURIFromEnv(), &tls.Config{}, slog.New(slog.DiscardHandler))
+	name, err := tap.getTapQueueNameForExchange("exchange", "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "__tap-queue-for-exchange-1234", name)
 }
 
 func TestGetTapEchangeNameForExchange(t *testing.T) {
-	assert.Equal(t, "__tap-exchange-for-exchange-1234",
-		getTapExchangeNameForExchange("exchange", "1234"))
+	tap := NewAmqpTap(AmqpTapConfig{}, testcommon.IntegrationURIFromEnv(), &tls.Config{}, slog.New(slog.DiscardHandler))
+	name, err := tap.getTapExchangeNameForExchange("exchange", "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "__tap-exchange-for-exchange-1234", name)
+}
+
+func TestTapNameUsesPrefixAndTemplate(t *testing.T) {
+	config := AmqpTapConfig{NamePrefix: "team-a.", NameTemplate: "{{.Prefix}}{{.Exchange}}.{{.Kind}}.{{.ID}}"}
+	name, err := config.tapName("queue", "exchange", "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a.exchange.queue.1234", name)
+}
+
+func TestTapNameUsesDefaultTemplateWithPrefix(t *testing.T) {
+	config := AmqpTapConfig{NamePrefix: "team-a."}
+	name, err := config.tapName("exchange", "exchange", "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a.exchange-for-exchange-1234", name)
+}
+
+func TestValidateFailsOnInvalidTemplate(t *testing.T) {
+	assert.Error(t, AmqpTapConfig{NameTemplate: "{{.Prefix"}.Validate())
+	assert.Error(t, AmqpTapConfig{NameTemplate: "{{.Unknown}}"}.Validate())
+	assert.NoError(t, AmqpTapConfig{}.Validate())
+}
+
+func TestValidateFailsOnTemplateWithoutID(t *testing.T) {
+	err := AmqpTapConfig{NameTemplate: "{{.Prefix}}{{.Kind}}-{{.Exchange}}"}.Validate()
+	assert.ErrorContains(t, err, ".ID")
+}
+
+func TestValidateFailsOnTemplateWithoutExchange(t *testing.T) {
+	err := AmqpTapConfig{NameTemplate: "{{.Prefix}}{{.Kind}}-{{.ID}}"}.Validate()
+	assert.ErrorContains(t, err, ".Exchange")
+}
+
+func TestTapNamePatternMatchesNamesOfTapResources(t *testing.T) {
+	config := AmqpTapConfig{NamePrefix: "team.a-"}
+	pattern, err := config.TapNamePattern("queue")
+	require.NoError(t, err)
+
+	assert.True(t, pattern.MatchString("team.a-queue-for-amq.topic-0123abcd-4ef"))
+	assert.False(t, pattern.MatchString("team.a-exchange-for-amq.topic-0123abcd-4ef"))
+	assert.False(t, pattern.MatchString("teamXa-queue-for-amq.topic-0123abcd-4ef"))
+	assert.False(t, pattern.MatchString("team.a-queue-for-amq.topic"))
+	assert.False(t, pattern.MatchString("orders"))
+}
+
+func TestTapNamePatternUsesTemplate(t *testing.T) {
+	config := AmqpTapConfig{NamePrefix: "team-a.", NameTemplate: "{{.Exchange}}.{{.Kind}}.{{.Prefix}}{{.ID}}"}
+	pattern, err := config.TapNamePattern("exchange")
+	require.NoError(t, err)
+
+	assert.True(t, pattern.MatchString("orders.exchange.team-a.0123abcd-4ef"))
+	assert.False(t, pattern.MatchString("orders.queue.team-a.0123abcd-4ef"))
+}
+
+func TestTapNamePatternCapturesID(t *testing.T) {
+	pattern, err := AmqpTapConfig{}.TapNamePattern("queue")
+	require.NoError(t, err)
+
+	match := pattern.FindStringSubmatch("__tap-queue-for-amq.topic-0123abcd-4ef")
+	require.NotNil(t, match)
+	assert.Equal(t, "0123abcd-4ef", match[pattern.SubexpIndex("id")])
+}
+
+func TestTapNamePatternFailsWithoutPrefixInTemplate(t *testing.T) {
+	_, err := AmqpTapConfig{NameTemplate: "{{.Exchange}}-{{.ID}}"}.TapNamePattern("queue")
+	assert.Error(t, err)
+}
+
+func TestQueueArgsAreEmptyByDefault(t *testing.T) {
+	assert.Nil(t, AmqpTapConfig{}.queueArgs())
+}
+
+func TestQueueArgsBoundTheTapQueue(t *testing.T) {
+	config := AmqpTapConfig{MaxLength: 1000, MaxLengthBytes: 1 << 20, MessageTTL: time.Minute}
+	assert.Equal(t, amqp.Table{
+		"x-max-length":       int64(1000),
+		"x-max-length-bytes": int64(1 << 20),
+		"x-overflow":         "drop-head",
+		"x-message-ttl":      int64(60000),
+	}, config.queueArgs())
+}
+
+func TestQueueArgsWithTTLOnly(t *testing.T) {
+	config := AmqpTapConfig{MessageTTL: time.Second}
+	assert.Equal(t, amqp.Table{"x-message-ttl": int64(1000)}, config.queueArgs())
 }
 
 func verifyMessagesOnTap(t *testing.T, consumer string, numExpected int,
-	tapExchangeName, tapQueueName string,
+	exchangeConfig ExchangeConfiguration,
 	success chan<- int,
 ) *AmqpTap {
 	logger := slog.New(slog.DiscardHandler)
-	tap := NewAmqpTap(testcommon.IntegrationURIFromEnv(), &tls.Config{}, logger)
+	tap := NewAmqpTap(AmqpTapConfig{}, testcommon.IntegrationURIFromEnv(), &tls.Config{}, logger)
 	resultChannel := make(TapChannel)
 	resultErrChannel := make(SubscribeErrorChannel)
 
@@ -55,9 +144,7 @@ func verifyMessagesOnTap(t *testing.T, consumer string, numExpected int,
 		defer close(tapDone)
 		_ = tap.EstablishTap(
 			ctx,
-			[]ExchangeConfiguration{
-				{tapExchangeName, tapQueueName},
-			},
+			[]ExchangeConfiguration{exchangeConfig},
 			resultChannel,
 			resultErrChannel)
 	}()
@@ -87,6 +174,8 @@ func verifyMessagesOnTap(t *testing.T, consumer string, numExpected int,
 						numReceived++
 					}
 				}
+				assert.Equal(t, exchangeConfig.Exchange, message.Source.Exchange)
+				assert.Equal(t, exchangeConfig.BindingKey, message.Source.BindingKey)
 			}
 		}
 	}()
@@ -114,7 +203,8 @@ func TestIntegrationHeadersExchange(t *testing.T) {
 	finishChan := make(chan int)
 
 	// no binding key is needed for the headers exchange
-	go verifyMessagesOnTap(t, "tap-consumer1", messagesPerTest, "headers-exchange", "", finishChan)
+	go verifyMessagesOnTap(t, "tap-consumer1", messagesPerTest,
+		ExchangeConfiguration{Exchange: "headers-exchange"}, finishChan)
 	time.Sleep(TapReadyDelay)
 
 	// inject messages into exchange. Each message should become visible
@@ -131,6 +221,33 @@ func TestIntegrationHeadersExchange(t *testing.T) {
 	requireIntFromChan(t, finishChan, messagesPerTest)
 }
 
+// TestIntegrationHeadersExchangeWithHeaderMatch tests tapping to a headers
+// exchange using header matches, so only messages with matching headers are
+// tapped.
+func TestIntegrationHeadersExchangeWithHeaderMatch(t *testing.T) {
+	messagesPerTest := 5
+	exchangeName := "headers-exchange-" + uuid.New().String()
+
+	setup, err := testcommon.IntegrationTestConnection(exchangeName, "headers", 2, true)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+
+	finishChan := make(chan int)
+
+	// tap only messages with header1=test1
+	exchangeConfig := ExchangeConfiguration{
+		Exchange:    exchangeName,
+		BindingArgs: KeyValueMap{"x-match": "all", "header1": "test1"},
+	}
+	go verifyMessagesOnTap(t, "tap-consumer1", messagesPerTest, exchangeConfig, finishChan)
+	time.Sleep(TapReadyDelay)
+
+	testcommon.PublishTestMessages(t, setup.Chan, messagesPerTest, exchangeName, "", amqp.Table{"header1": "test0"})
+	testcommon.PublishTestMessages(t, setup.Chan, messagesPerTest, exchangeName, "", amqp.Table{"header1": "test1"})
+
+	requireIntFromChan(t, finishChan, messagesPerTest)
+}
+
 func TestIntegrationDirectExchange(t *testing.T) {
 	// establish sending exchange
 	setup, err := testcommon.IntegrationTestConnection("direct-exchange", "direct", 2, false)
@@ -142,7 +259,8 @@ func TestIntegrationDirectExchange(t *testing.T) {
 	// connect a test-tap and check if we received the test message
 	messagesPerTest := 5
 
-	go verifyMessagesOnTap(t, "tap-consumer1", messagesPerTest, "direct-exchange", setup.QueueName(0), finishChan)
+	go verifyMessagesOnTap(t, "tap-consumer1", messagesPerTest,
+		ExchangeConfiguration{Exchange: "direct-exchange", BindingKey: setup.QueueName(0)}, finishChan)
 
 	time.Sleep(TapReadyDelay)
 
@@ -176,7 +294,8 @@ func TestIntegrationTopicExchangeTapSingleQueue(t *testing.T) {
 	messagesPerTest := 5
 
 	// tap only messages routed to queue-0
-	go verifyMessagesOnTap(t, "tap-consumer1", messagesPerTest, exchangeName, setup.QueueName(0), finishChan)
+	go verifyMessagesOnTap(t, "tap-consumer1", messagesPerTest,
+		ExchangeConfiguration{Exchange: exchangeName, BindingKey: setup.QueueName(0)}, finishChan)
 
 	time.Sleep(TapReadyDelay)
 
@@ -213,7 +332,8 @@ func TestIntegrationTopicExchangeTapWildcard(t *testing.T) {
 	messagesPerTest := 5
 
 	// tap all messages on the exchange
-	go verifyMessagesOnTap(t, "tap-consumer1", messagesPerTest*2, exchangeName, "#", finishChan)
+	go verifyMessagesOnTap(t, "tap-consumer1", messagesPerTest*2,
+		ExchangeConfiguration{Exchange: exchangeName, BindingKey: "#"}, finishChan)
 
 	time.Sleep(TapReadyDelay)
 
@@ -238,15 +358,90 @@ func TestIntegrationInvalidExchange(t *testing.T) {
 	tapMessages := make(TapChannel)
 	errChannel := make(SubscribeErrorChannel)
 	logger := slog.New(slog.DiscardHandler)
-	tap := NewAmqpTap(testcommon.IntegrationURIFromEnv(), &tls.Config{}, logger)
+	tap := NewAmqpTap(AmqpTapConfig{}, testcommon.IntegrationURIFromEnv(), &tls.Config{}, logger)
 	ctx := context.Background()
 	err := tap.EstablishTap(
 		ctx,
 		[]ExchangeConfiguration{
-			{"nonexisting-exchange", "test"},
+			{Exchange: "nonexisting-exchange", BindingKey: "test"},
 		},
 		tapMessages,
 		errChannel)
 
 	assert.NotNil(t, err)
 }
+
+// TestIntegrationTapWithPreProvisionedQueue taps through an existing queue,
+// which is bound to the tapped exchange and unbound when the tap ends.
+func TestIntegrationTapWithPreProvisionedQueue(t *testing.T) {
+	const queue = "pre-provisioned-tap-queue"
+	const key = "pre-provisioned-tap-test"
+
+	setup, err := testcommon.IntegrationTestConnection("", "", 0, false)
+	require.NoError(t, err)
+	defer func() { _ = setup.Conn.Close() }()
+	_, err = setup.Chan.QueueDeclare(queue, false, false, false, false, nil)
+	require.NoError(t, err)
+	defer func() { _, _ = setup.Chan.QueueDelete(queue, false, false, false) }()
+
+	logger := slog.New(slog.DiscardHandler)
+	tap := NewAmqpTap(AmqpTapConfig{Queue: queue}, testcommon.IntegrationURIFromEnv(), &tls.Config{}, logger)
+	resultChannel := make(TapChannel)
+	errChannel := make(SubscribeErrorChannel)
+	ctx, cancel := context.WithCancel(context.Background())
+	tapDone := make(chan struct{})
+	go func() {
+		defer close(tapDone)
+		_ = tap.EstablishTap(ctx,
+			[]ExchangeConfiguration{{Exchange: "amq.topic", BindingKey: key}},
+			resultChannel, errChannel)
+	}()
+	time.Sleep(TapReadyDelay)
+
+	err = setup.Chan.Publish("amq.topic", key, false, false, amqp.Publishing{Body: []byte("Hello")})
+	require.NoError(t, err)
+
+	select {
+	case message := <-resultChannel:
+		assert.Equal(t, "Hello", string(message.AmqpMessage.Body))
+		_ = message.AmqpMessage.Ack(false)
+	case <-time.After(ResultTimeout):
+		assert.Fail(t, "message not received on tap")
+	}
+	cancel()
+	<-tapDone
+
+	// the binding is removed, so the queue must no longer receive messages
+	err = setup.Chan.Publish("amq.topic", key, false, false, amqp.Publishing{Body: []byte("Hello")})
+	require.NoError(t, err)
+	time.Sleep(TapReadyDelay)
+	q, err := setup.Chan.QueueDeclarePassive(queue, false, false, false, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, q.Messages)
+}
+
+// TestIntegrationBoundedTapCallsOnTeardownWithTapQueues taps with a bounded
+// tap queue and expects the teardown hook to be called with the tap queue.
+func TestIntegrationBoundedTapCallsOnTeardownWithTapQueues(t *testing.T) {
+	var tornDown []string
+	config := AmqpTapConfig{
+		MaxLength:  10,
+		MessageTTL: time.Minute,
+		OnTeardown: func(queues []string) { tornDown = queues },
+	}
+	logger := slog.New(slog.DiscardHandler)
+	tap := NewAmqpTap(config, testcommon.IntegrationURIFromEnv(), &tls.Config{}, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	tapDone := make(chan error)
+	go func() {
+		tapDone <- tap.EstablishTap(ctx,
+			[]ExchangeConfiguration{{Exchange: "amq.topic", BindingKey: "#"}},
+			make(TapChannel), make(SubscribeErrorChannel))
+	}()
+	time.Sleep(TapReadyDelay)
+	cancel()
+
+	require.NoError(t, <-tapDone)
+	require.Len(t, tornDown, 1)
+	assert.True(t, strings.HasPrefix(tornDown[0], "__tap-queue-for-amq.topic-"))
+}
@@ -21,7 +21,8 @@ const (
 // NewRabbitAPIMock returns a mock server for the rabbitmq http managemet
 // API. It is used by the integration test. Only a very limited subset
 // of resources is support (GET exchanges, bindings, queues, overviews,
-// channels, connections; DELETE connections)
+// channels, connections, a single queue; DELETE connections, exchanges,
+// queues; PUT vhosts)
 // Usage:
 //
 //	mockServer := NewRabbitAPIMock(MockModeStd)
@@ -52,6 +53,8 @@ func mockStdHandler(w http.ResponseWriter, r *http.Request) {
 		mockStdGetHandler(w, r)
 	case "DELETE":
 		mockStdDeleteHandler(w, r)
+	case "PUT":
+		mockStdPutHandler(w, r)
 	default:
 		w.WriteHeader(http.StatusBadRequest)
 	}
@@ -76,6 +79,8 @@ func mockStdGetHandler(w http.ResponseWriter, r *http.Request) {
 		result = channelResult
 	case "/connections":
 		result = connectionResult
+	case "/queues/%2F/tap-q1":
+		result = tapQueueResult
 	default:
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -86,7 +91,20 @@ func mockStdGetHandler(w http.ResponseWriter, r *http.Request) {
 
 func mockStdDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.RequestURI() {
-	case "/connections/172.17.0.1:40874%20-%3E%20172.17.0.2:5672":
+	case "/connections/172.17.0.1:40874%20-%3E%20172.17.0.2:5672",
+		"/exchanges/%2F/test-fanout", "/exchanges/%2F/test-headers",
+		"/exchanges/%2F/test-topic", "/queues/%2F/direct-q2",
+		"/queues/%2F/fanout-q1", "/queues/%2F/fanout-q2":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+	_, _ = fmt.Fprint(w, "")
+}
+
+func mockStdPutHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.RequestURI() {
+	case "/vhosts/%2F":
 		w.WriteHeader(http.StatusNoContent)
 	default:
 		w.WriteHeader(http.StatusNotFound)
@@ -427,6 +445,8 @@ const (
 `
 
 	// result of GET /api/queues
+	tapQueueResult = `{"name":"tap-q1","vhost":"/","messages":12,"messages_ready":10,"messages_unacknowledged":2,"message_stats":{"publish":100,"deliver_get":60}}`
+
 	queueResult = `
 [
     {